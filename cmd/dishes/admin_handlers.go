@@ -0,0 +1,282 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/shohin-cloud/dishes-api/pkg/dishes/model"
+	"github.com/shohin-cloud/dishes-api/pkg/dishes/validator"
+)
+
+// getAdminMember looks up the member given in the URL. It sends the error response itself
+// and returns nil if the member doesn't exist.
+func (app *application) getAdminMember(w http.ResponseWriter, r *http.Request) *model.Member {
+	id, err := strconv.ParseInt(mux.Vars(r)["memberId"], 10, 64)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil
+	}
+
+	member, err := app.models.Members.GetByID(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+
+	return member
+}
+
+// memberGrants are the roles and direct permissions of a member, as recorded in the audit log.
+type memberGrants struct {
+	Roles       []string          `json:"roles"`
+	Permissions model.Permissions `json:"permissions"`
+}
+
+func (app *application) getMemberGrants(memberID int64) (*memberGrants, error) {
+	roles, err := app.models.Permissions.GetRolesForMember(memberID)
+	if err != nil {
+		return nil, err
+	}
+
+	direct, err := app.models.Permissions.GetDirectForMember(memberID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &memberGrants{Roles: roles, Permissions: direct}, nil
+}
+
+// auditMemberGrants records a change of the roles or direct permissions of a member, given
+// their grants from before the change.
+func (app *application) auditMemberGrants(r *http.Request, action string, memberID int64, before *memberGrants) {
+	after, err := app.getMemberGrants(memberID)
+	if err != nil {
+		app.logError(r, err)
+		return
+	}
+
+	app.audit(r, action, model.AuditEntityMember, memberID, before, after)
+}
+
+// writeMemberPermissions sends the roles, direct grants and effective permissions of a member.
+func (app *application) writeMemberPermissions(w http.ResponseWriter, r *http.Request, member *model.Member) {
+	roles, err := app.models.Permissions.GetRolesForMember(member.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	direct, err := app.models.Permissions.GetDirectForMember(member.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	effective, err := app.models.Permissions.GetAllForMember(member.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{
+		"member_id":   member.ID,
+		"roles":       roles,
+		"permissions": direct,
+		"effective":   effective,
+	}
+
+	err = app.writeJSON(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listMemberPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	member := app.getAdminMember(w, r)
+	if member == nil {
+		return
+	}
+
+	app.writeMemberPermissions(w, r, member)
+}
+
+func (app *application) grantMemberPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	member := app.getAdminMember(w, r)
+	if member == nil {
+		return
+	}
+
+	var input struct {
+		Permissions []string `json:"permissions"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	known, err := app.models.Permissions.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if model.ValidatePermissionCodes(v, input.Permissions, known); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	before, err := app.getMemberGrants(member.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Permissions.AddForMember(member.ID, input.Permissions...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.auditMemberGrants(r, model.AuditActionGrantPermissions, member.ID, before)
+
+	app.writeMemberPermissions(w, r, member)
+}
+
+func (app *application) revokeMemberPermissionHandler(w http.ResponseWriter, r *http.Request) {
+	member := app.getAdminMember(w, r)
+	if member == nil {
+		return
+	}
+
+	code := mux.Vars(r)["code"]
+
+	known, err := app.models.Permissions.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !known.Include(code) {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Removing the direct grant wouldn't take the permission away from a member whose roles
+	// grant it too.
+	fromRoles, err := app.models.Permissions.GetFromRolesForMember(member.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if fromRoles.Include(code) {
+		app.permissionHeldByRoleResponse(w, r)
+		return
+	}
+
+	before, err := app.getMemberGrants(member.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Permissions.RemoveForMember(member.ID, code)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.auditMemberGrants(r, model.AuditActionRevokePermission, member.ID, before)
+
+	err = app.revokeSignedSessionsForPermissions(member.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeMemberPermissions(w, r, member)
+}
+
+func (app *application) setMemberRolesHandler(w http.ResponseWriter, r *http.Request) {
+	member := app.getAdminMember(w, r)
+	if member == nil {
+		return
+	}
+
+	var input struct {
+		Roles []string `json:"roles"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if model.ValidateRoles(v, input.Roles); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	before, err := app.getMemberGrants(member.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Permissions.SetRoles(member.ID, input.Roles...)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrUnknownRole):
+			v.AddError("roles", "must only contain existing roles")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.auditMemberGrants(r, model.AuditActionSetRoles, member.ID, before)
+
+	err = app.revokeSignedSessionsForPermissions(member.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeMemberPermissions(w, r, member)
+}
+
+// unlockMemberHandler lifts the login lockout of a member and forgets their failed logins.
+func (app *application) unlockMemberHandler(w http.ResponseWriter, r *http.Request) {
+	member := app.getAdminMember(w, r)
+	if member == nil {
+		return
+	}
+
+	err := app.resetLoginFailures([]loginKey{{key: emailLoginKey(member.Email)}})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.audit(r, model.AuditActionUnlock, model.AuditEntityMember, member.ID, nil, nil)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "member successfully unlocked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
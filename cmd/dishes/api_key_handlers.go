@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/shohin-cloud/dishes-api/pkg/dishes/model"
+	"github.com/shohin-cloud/dishes-api/pkg/dishes/validator"
+)
+
+// memberForApiKey looks up the member an API key belongs to. The member's permissions are
+// narrowed down to the ones given to the key, so revoking a permission from the member also
+// takes it away from their keys.
+func (app *application) memberForApiKey(plaintext string) (*model.Member, *model.ApiKey, error) {
+	v := validator.New()
+	if model.ValidateApiKeyPlaintext(v, plaintext); !v.Valid() {
+		return nil, nil, model.ErrRecordNotFound
+	}
+
+	key, err := app.models.ApiKeys.GetForKey(plaintext)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	member, err := app.models.Members.GetByID(key.MemberID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	granted, err := app.models.Permissions.GetAllForMember(member.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	member.Permissions = model.Permissions{}
+	for _, code := range key.Permissions {
+		if granted.Include(code) {
+			member.Permissions = append(member.Permissions, code)
+		}
+	}
+
+	err = app.models.ApiKeys.Touch(key.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return member, key, nil
+}
+
+func (app *application) createApiKeyHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name        string     `json:"name"`
+		Permissions []string   `json:"permissions"`
+		Expiry      *time.Time `json:"expiry"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	member := app.contextGetMember(r)
+
+	granted, err := app.memberPermissions(member)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	key, err := model.NewApiKey(member.ID, input.Name, input.Permissions, input.Expiry)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if model.ValidateApiKey(v, key, granted); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.ApiKeys.Insert(key)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"api_key": key}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listApiKeysHandler(w http.ResponseWriter, r *http.Request) {
+	member := app.contextGetMember(r)
+
+	keys, err := app.models.ApiKeys.GetAllForMember(member.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"api_keys": keys}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteApiKeyHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["keyId"], 10, 64)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	member := app.contextGetMember(r)
+
+	err = app.models.ApiKeys.Delete(id, member.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "api key successfully revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/shohin-cloud/dishes-api/pkg/dishes/model"
+	"github.com/shohin-cloud/dishes-api/pkg/dishes/validator"
+)
+
+// audit records a change in the audit log, attributed to the member making the request. The
+// change has already been made when this is called, so a failure is logged instead of being
+// sent to the client.
+func (app *application) audit(r *http.Request, action, entityType string, entityID interface{}, before, after interface{}) {
+	changes, err := model.AuditDiff(before, after)
+	if err != nil {
+		app.logError(r, err)
+		return
+	}
+
+	entry := &model.AuditEntry{
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   fmt.Sprint(entityID),
+		Changes:    changes,
+		RequestID:  app.contextGetRequestID(r),
+		IP:         app.clientIP(r),
+	}
+
+	if member := app.contextGetMember(r); !member.IsAnonymous() {
+		entry.ActorID = &member.ID
+	}
+
+	err = app.models.Audit.Insert(entry)
+	if err != nil {
+		app.logError(r, err)
+	}
+}
+
+// listAuditHandler lists the audit log, newest entries first.
+func (app *application) listAuditHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		model.AuditFilter
+		model.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.AuditFilter.ActorID = int64(app.readInt(qs, "actor_id", 0, v))
+	input.AuditFilter.Action = app.readString(qs, "action", "")
+	input.AuditFilter.EntityType = app.readString(qs, "entity_type", "")
+	input.AuditFilter.EntityID = app.readString(qs, "entity_id", "")
+	input.AuditFilter.Since = app.readTime(qs, "since", v)
+	input.AuditFilter.Until = app.readTime(qs, "until", v)
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	app.rejectCursor(qs, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "-id")
+
+	input.Filters.SortSafelist = []string{"id", "-id"}
+
+	model.ValidateAuditFilter(v, input.AuditFilter)
+
+	if model.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	entries, metadata, err := app.models.Audit.GetAll(input.AuditFilter, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"audit": entries, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
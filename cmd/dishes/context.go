@@ -5,11 +5,18 @@ import (
 	"net/http"
 
 	"github.com/shohin-cloud/dishes-api/pkg/dishes/model"
+	"github.com/shohin-cloud/dishes-api/pkg/jwt"
 )
 
 type contextKey string
 
-const memberContextKey = contextKey("member")
+const (
+	memberContextKey    = contextKey("member")
+	tokenContextKey     = contextKey("token")
+	claimsContextKey    = contextKey("claims")
+	apiKeyContextKey    = contextKey("apiKey")
+	requestIDContextKey = contextKey("requestID")
+)
 
 func (app *application) contextSetMember(r *http.Request, member *model.Member) *http.Request {
 	ctx := context.WithValue(r.Context(), memberContextKey, member)
@@ -23,3 +30,53 @@ func (app *application) contextGetMember(r *http.Request) *model.Member {
 	}
 	return member
 }
+
+// contextSetToken stores the plaintext authentication token the request was made with.
+func (app *application) contextSetToken(r *http.Request, token string) *http.Request {
+	ctx := context.WithValue(r.Context(), tokenContextKey, token)
+	return r.WithContext(ctx)
+}
+
+// contextGetToken returns the authentication token of the request, or "" for anonymous
+// requests.
+func (app *application) contextGetToken(r *http.Request) string {
+	token, _ := r.Context().Value(tokenContextKey).(string)
+	return token
+}
+
+// contextSetClaims stores the claims of the signed token the request was made with.
+func (app *application) contextSetClaims(r *http.Request, claims *jwt.Claims) *http.Request {
+	ctx := context.WithValue(r.Context(), claimsContextKey, claims)
+	return r.WithContext(ctx)
+}
+
+// contextGetClaims returns the claims of the signed token of the request, or nil if the
+// request wasn't made with one.
+func (app *application) contextGetClaims(r *http.Request) *jwt.Claims {
+	claims, _ := r.Context().Value(claimsContextKey).(*jwt.Claims)
+	return claims
+}
+
+// contextSetApiKey stores the API key the request was authenticated with.
+func (app *application) contextSetApiKey(r *http.Request, key *model.ApiKey) *http.Request {
+	ctx := context.WithValue(r.Context(), apiKeyContextKey, key)
+	return r.WithContext(ctx)
+}
+
+// contextGetApiKey returns the API key of the request, or nil if it wasn't made with one.
+func (app *application) contextGetApiKey(r *http.Request) *model.ApiKey {
+	key, _ := r.Context().Value(apiKeyContextKey).(*model.ApiKey)
+	return key
+}
+
+// contextSetRequestID stores the ID the request is logged and answered with.
+func (app *application) contextSetRequestID(r *http.Request, id string) *http.Request {
+	ctx := context.WithValue(r.Context(), requestIDContextKey, id)
+	return r.WithContext(ctx)
+}
+
+// contextGetRequestID returns the ID of the request, or "" if it hasn't been assigned one.
+func (app *application) contextGetRequestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDContextKey).(string)
+	return id
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 
 	"github.com/gorilla/mux"
@@ -9,23 +11,6 @@ import (
 	"github.com/shohin-cloud/dishes-api/pkg/dishes/validator"
 )
 
-func (app *application) respondWithError(w http.ResponseWriter, code int, message string) {
-	app.respondWithJson(w, code, map[string]string{"error": message})
-}
-
-func (app *application) respondWithJson(w http.ResponseWriter, code int, payload interface{}) {
-	response, err := json.Marshal(payload)
-
-	if err != nil {
-		app.respondWithError(w, http.StatusInternalServerError, "500 Internal Server Error")
-		return
-	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(code)
-	w.Write(response)
-}
-
 func (app *application) createDishHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
 		Name        string  `json:"name"`
@@ -35,7 +20,7 @@ func (app *application) createDishHandler(w http.ResponseWriter, r *http.Request
 
 	err := app.readJSON(w, r, &input)
 	if err != nil {
-		app.respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		app.badRequestResponse(w, r, err)
 		return
 	}
 
@@ -45,19 +30,39 @@ func (app *application) createDishHandler(w http.ResponseWriter, r *http.Request
 		Price:       input.Price,
 	}
 
+	v := validator.New()
+
+	if model.ValidateDish(v, dish); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
 	err = app.models.Dishes.Insert(dish)
 	if err != nil {
-		app.respondWithError(w, http.StatusInternalServerError, "Failed to create dish")
+		switch {
+		case errors.Is(err, model.ErrDuplicateDishName):
+			v.AddError("name", "a dish with this name already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
-	app.respondWithJson(w, http.StatusCreated, dish)
+	app.audit(r, model.AuditActionCreate, model.AuditEntityDish, dish.ID, nil, dish)
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/api/v1/dishes/%s", dish.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"dish": dish}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
 }
 
 func (app *application) getAllDishesHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Name  string
-		Price string
+		Name string
 		model.Filters
 	}
 
@@ -66,7 +71,7 @@ func (app *application) getAllDishesHandler(w http.ResponseWriter, r *http.Reque
 	qs := r.URL.Query()
 
 	input.Name = app.readString(qs, "name", "")
-	input.Price = app.readString(qs, "price", "")
+	app.readCatalogFilters(qs, &input.Filters, v)
 
 	input.Filters.Page = app.readInt(qs, "page", 1, v)
 	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
@@ -74,18 +79,19 @@ func (app *application) getAllDishesHandler(w http.ResponseWriter, r *http.Reque
 	input.Filters.Sort = app.readString(qs, "sort", "id")
 
 	input.Filters.SortSafelist = []string{
-		"id", "name", "price",
-		"-id", "-name", "-price",
+		"id", "name", "price", "relevance",
+		"-id", "-name", "-price", "-relevance",
 	}
 
 	if model.ValidateFilters(v, input.Filters); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
-	dishes, metadata, err := app.models.Dishes.GetAll(input.Name, input.Price, input.Filters)
+	dishes, metadata, err := app.models.Dishes.GetAll(input.Name, input.Filters)
 
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
+		return
 	}
 
 	err = app.writeJSON(w, http.StatusOK, envelope{"dishes": dishes, "metadata": metadata}, nil)
@@ -99,12 +105,51 @@ func (app *application) getDishByIdHandler(w http.ResponseWriter, r *http.Reques
 	vars := mux.Vars(r)
 	param := vars["dishId"]
 
+	v := validator.New()
+
+	// The include parameter embeds related resources in the response, e.g. ?include=ingredients.
+	include := app.readCSV(r.URL.Query(), "include", []string{})
+	for _, value := range include {
+		v.Check(validator.In(value, "ingredients"), "include", "invalid include value")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
 	dish, err := app.models.Dishes.GetById(param)
 	if err != nil {
-		app.respondWithError(w, http.StatusNotFound, "Dish not found")
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	average, count, err := app.models.Reviews.RatingForDish(dish.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
 		return
 	}
-	app.respondWithJson(w, http.StatusOK, dish)
+	dish.AverageRating = &average
+	dish.ReviewCount = &count
+
+	if validator.In("ingredients", include...) {
+		dish.Ingredients, err = app.models.Ingredients.GetAllForDish(dish.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	w.Header().Set("ETag", etag(dish.Version))
+	err = app.writeJSON(w, http.StatusOK, envelope{"dish": dish}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
 }
 
 func (app *application) updateDishHandler(w http.ResponseWriter, r *http.Request) {
@@ -113,7 +158,19 @@ func (app *application) updateDishHandler(w http.ResponseWriter, r *http.Request
 
 	dish, err := app.models.Dishes.GetById(param)
 	if err != nil {
-		app.respondWithError(w, http.StatusNotFound, "Dish not found")
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	before := *dish
+
+	if !app.ifMatch(r, dish.Version) {
+		app.preconditionFailedResponse(w, r)
 		return
 	}
 
@@ -125,7 +182,7 @@ func (app *application) updateDishHandler(w http.ResponseWriter, r *http.Request
 
 	err = app.readJSON(w, r, &input)
 	if err != nil {
-		app.respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		app.badRequestResponse(w, r, err)
 		return
 	}
 
@@ -139,26 +196,104 @@ func (app *application) updateDishHandler(w http.ResponseWriter, r *http.Request
 		dish.Price = *input.Price
 	}
 
+	v := validator.New()
+
+	if model.ValidateDish(v, dish); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
 	err = app.models.Dishes.Update(dish)
 	if err != nil {
-		app.respondWithError(w, http.StatusInternalServerError, "Failed to update dish")
+		switch {
+		case errors.Is(err, model.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, model.ErrDuplicateDishName):
+			v.AddError("name", "a dish with this name already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
-	app.respondWithJson(w, http.StatusOK, dish)
+	app.audit(r, model.AuditActionUpdate, model.AuditEntityDish, dish.ID, &before, dish)
+
+	w.Header().Set("ETag", etag(dish.Version))
+	err = app.writeJSON(w, http.StatusOK, envelope{"dish": dish}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
 }
 
 func (app *application) deleteDishHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	param := vars["dishId"]
 
-	err := app.models.Dishes.Delete(param)
+	dish, err := app.models.Dishes.GetById(param)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Dishes.Delete(dish.ID)
 	if err != nil {
-		app.respondWithError(w, http.StatusInternalServerError, "Failed to delete dish")
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
-	app.respondWithJson(w, http.StatusOK, map[string]string{"message": "Dish deleted successfully"})
+	app.audit(r, model.AuditActionDelete, model.AuditEntityDish, dish.ID, dish, nil)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "dish moved to trash"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// restoreDishHandler takes a dish out of the trash, together with the ingredients that were
+// deleted along with it.
+func (app *application) restoreDishHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	param := vars["dishId"]
+
+	err := app.models.Dishes.Restore(param)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, model.ErrDuplicateDishName):
+			v := validator.New()
+			v.AddError("name", "a dish with this name already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	dish, err := app.models.Dishes.GetById(param)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.audit(r, model.AuditActionRestore, model.AuditEntityDish, dish.ID, nil, dish)
+
+	w.Header().Set("ETag", etag(dish.Version))
+	err = app.writeJSON(w, http.StatusOK, envelope{"dish": dish}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
 }
 
 func (app *application) readJSON(w http.ResponseWriter, r *http.Request, dst interface{}) error {
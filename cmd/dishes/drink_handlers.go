@@ -1,6 +1,8 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 
 	"github.com/gorilla/mux"
@@ -17,7 +19,7 @@ func (app *application) createDrinkHandler(w http.ResponseWriter, r *http.Reques
 
 	err := app.readJSON(w, r, &input)
 	if err != nil {
-		app.respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		app.badRequestResponse(w, r, err)
 		return
 	}
 
@@ -27,19 +29,39 @@ func (app *application) createDrinkHandler(w http.ResponseWriter, r *http.Reques
 		Price:       input.Price,
 	}
 
+	v := validator.New()
+
+	if model.ValidateDrink(v, drink); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
 	err = app.models.Drinks.Insert(drink)
 	if err != nil {
-		app.respondWithError(w, http.StatusInternalServerError, "Failed to create drink")
+		switch {
+		case errors.Is(err, model.ErrDuplicateDrinkName):
+			v.AddError("name", "a drink with this name already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
-	app.respondWithJson(w, http.StatusCreated, drink)
+	app.audit(r, model.AuditActionCreate, model.AuditEntityDrink, drink.ID, nil, drink)
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/api/v1/drinks/%s", drink.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"drink": drink}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
 }
 
 func (app *application) getAllDrinksHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Name  string
-		Price string
+		Name string
 		model.Filters
 	}
 
@@ -48,7 +70,7 @@ func (app *application) getAllDrinksHandler(w http.ResponseWriter, r *http.Reque
 	qs := r.URL.Query()
 
 	input.Name = app.readString(qs, "name", "")
-	input.Price = app.readString(qs, "price", "")
+	app.readCatalogFilters(qs, &input.Filters, v)
 
 	input.Filters.Page = app.readInt(qs, "page", 1, v)
 	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
@@ -56,18 +78,19 @@ func (app *application) getAllDrinksHandler(w http.ResponseWriter, r *http.Reque
 	input.Filters.Sort = app.readString(qs, "sort", "id")
 
 	input.Filters.SortSafelist = []string{
-		"id", "name", "price",
-		"-id", "-name", "-price",
+		"id", "name", "price", "relevance",
+		"-id", "-name", "-price", "-relevance",
 	}
 
 	if model.ValidateFilters(v, input.Filters); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
-	drinks, metadata, err := app.models.Drinks.GetAll(input.Name, input.Price, input.Filters)
+	drinks, metadata, err := app.models.Drinks.GetAll(input.Name, input.Filters)
 
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
+		return
 	}
 
 	err = app.writeJSON(w, http.StatusOK, envelope{"drinks": drinks, "metadata": metadata}, nil)
@@ -83,10 +106,28 @@ func (app *application) getDrinkByIdHandler(w http.ResponseWriter, r *http.Reque
 
 	drink, err := app.models.Drinks.GetById(param)
 	if err != nil {
-		app.respondWithError(w, http.StatusNotFound, "Drink not found")
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	average, count, err := app.models.Reviews.RatingForDrink(drink.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
 		return
 	}
-	app.respondWithJson(w, http.StatusOK, drink)
+	drink.AverageRating = &average
+	drink.ReviewCount = &count
+
+	w.Header().Set("ETag", etag(drink.Version))
+	err = app.writeJSON(w, http.StatusOK, envelope{"drink": drink}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
 }
 
 func (app *application) updateDrinkHandler(w http.ResponseWriter, r *http.Request) {
@@ -95,7 +136,19 @@ func (app *application) updateDrinkHandler(w http.ResponseWriter, r *http.Reques
 
 	drink, err := app.models.Drinks.GetById(param)
 	if err != nil {
-		app.respondWithError(w, http.StatusNotFound, "Drink not found")
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	before := *drink
+
+	if !app.ifMatch(r, drink.Version) {
+		app.preconditionFailedResponse(w, r)
 		return
 	}
 
@@ -107,7 +160,7 @@ func (app *application) updateDrinkHandler(w http.ResponseWriter, r *http.Reques
 
 	err = app.readJSON(w, r, &input)
 	if err != nil {
-		app.respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		app.badRequestResponse(w, r, err)
 		return
 	}
 
@@ -121,24 +174,101 @@ func (app *application) updateDrinkHandler(w http.ResponseWriter, r *http.Reques
 		drink.Price = *input.Price
 	}
 
+	v := validator.New()
+
+	if model.ValidateDrink(v, drink); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
 	err = app.models.Drinks.Update(drink)
 	if err != nil {
-		app.respondWithError(w, http.StatusInternalServerError, "Failed to update drink")
+		switch {
+		case errors.Is(err, model.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, model.ErrDuplicateDrinkName):
+			v.AddError("name", "a drink with this name already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
-	app.respondWithJson(w, http.StatusOK, drink)
+	app.audit(r, model.AuditActionUpdate, model.AuditEntityDrink, drink.ID, &before, drink)
+
+	w.Header().Set("ETag", etag(drink.Version))
+	err = app.writeJSON(w, http.StatusOK, envelope{"drink": drink}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
 }
 
 func (app *application) deleteDrinkHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	param := vars["drinkId"]
 
-	err := app.models.Drinks.Delete(param)
+	drink, err := app.models.Drinks.GetById(param)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Drinks.Delete(drink.ID)
 	if err != nil {
-		app.respondWithError(w, http.StatusInternalServerError, "Failed to delete drink")
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
-	app.respondWithJson(w, http.StatusOK, map[string]string{"message": "Drink deleted successfully"})
+	app.audit(r, model.AuditActionDelete, model.AuditEntityDrink, drink.ID, drink, nil)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "drink moved to trash"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// restoreDrinkHandler takes a drink out of the trash.
+func (app *application) restoreDrinkHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	param := vars["drinkId"]
+
+	err := app.models.Drinks.Restore(param)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, model.ErrDuplicateDrinkName):
+			v := validator.New()
+			v.AddError("name", "a drink with this name already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	drink, err := app.models.Drinks.GetById(param)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.audit(r, model.AuditActionRestore, model.AuditEntityDrink, drink.ID, nil, drink)
+
+	w.Header().Set("ETag", etag(drink.Version))
+	err = app.writeJSON(w, http.StatusOK, envelope{"drink": drink}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
 }
@@ -2,24 +2,43 @@ package main
 
 import (
 	"fmt"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 // logError method is a generic helper for logging an error message in *application, as well
-// as the requested method and request URL.
+// as the requested method, request URL and request ID.
 func (app *application) logError(r *http.Request, err error) {
 	app.logger.PrintError(err, map[string]string{
 		"request_method": r.Method,
 		"request_url":    r.URL.String(),
+		"request_id":     app.contextGetRequestID(r),
 	})
 }
 
+// apiError is the body of every error response, sent to the client under the "error" key.
+// Code is a stable, machine-readable identifier of the error, Message is meant for humans and
+// may change. Fields holds the validation error of each invalid input field.
+type apiError struct {
+	Code      string            `json:"code"`
+	Message   string            `json:"message"`
+	Fields    map[string]string `json:"fields,omitempty"`
+	RequestID string            `json:"request_id,omitempty"`
+}
+
 // errorResponse method is a generic helper for sending JSON-formatted error messages to the
-// client with a given status code. Note that we're using an interface{} type for the message
-// parameter, rather than just a string type, as this gives us more flexibility over the values
-// that we can include in the response.
-func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, message interface{}) {
-	env := envelope{"error": message}
+// client with a given status code and error code.
+func (app *application) errorResponse(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	app.writeError(w, r, status, apiError{Code: code, Message: message})
+}
+
+// writeError sends e to the client, tagged with the ID of the request so that it can be found
+// in the logs.
+func (app *application) writeError(w http.ResponseWriter, r *http.Request, status int, e apiError) {
+	e.RequestID = app.contextGetRequestID(r)
+	env := envelope{"error": e}
 
 	// Write the response using the writeJSON() helper. If this happens to return an error
 	// then log it, and fall back to sending the client an empty response with a 500 Internal
@@ -39,26 +58,26 @@ func (app *application) serverErrorResponse(w http.ResponseWriter, r *http.Reque
 	app.logError(r, err)
 
 	message := "the server encountered a problem and could not process your request"
-	app.errorResponse(w, r, 500, message)
+	app.errorResponse(w, r, http.StatusInternalServerError, "internal_error", message)
 }
 
 // notFoundResponse method is used to send a 404 Not Found status code and JSON response to the
 // client.
 func (app *application) notFoundResponse(w http.ResponseWriter, r *http.Request) {
 	message := "the requested resource could not be found"
-	app.errorResponse(w, r, http.StatusNotFound, message)
+	app.errorResponse(w, r, http.StatusNotFound, "not_found", message)
 }
 
 // methodNotAllowedResponse method is used to send a 405 Method Not Allowed status code and
 // JSON response to the client.
 func (app *application) methodNotAllowedResponse(w http.ResponseWriter, r *http.Request) {
 	message := fmt.Sprintf("the %s method is not supported this resource", r.Method)
-	app.errorResponse(w, r, http.StatusMethodNotAllowed, message)
+	app.errorResponse(w, r, http.StatusMethodNotAllowed, "method_not_allowed", message)
 }
 
 // badRequestResponse sends JSON-formatted error message with 400 Bad Request status code.
 func (app *application) badRequestResponse(w http.ResponseWriter, r *http.Request, err error) {
-	app.errorResponse(w, r, http.StatusBadRequest, err.Error())
+	app.errorResponse(w, r, http.StatusBadRequest, "bad_request", err.Error())
 }
 
 // failedValidationResponse sends JSON-formatted error message to client with UnprocessableEntity
@@ -66,21 +85,63 @@ func (app *application) badRequestResponse(w http.ResponseWriter, r *http.Reques
 // Note that the errors parameter here has the type map[string]string,
 // which is exact the same as the errors map contained in our Validator type.
 func (app *application) failedValidationResponse(w http.ResponseWriter, r *http.Request, errors map[string]string) {
-	app.errorResponse(w, r, http.StatusUnprocessableEntity, errors)
+	app.writeError(w, r, http.StatusUnprocessableEntity, apiError{
+		Code:    "validation_failed",
+		Message: "the request contains invalid fields",
+		Fields:  errors,
+	})
 }
 
 // editConflictResponse sends a JSON-formatted error message to the client with a 409 Conflict
 // status code.
 func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Request) {
 	message := "unable to update the record due to an edit conflict, please try again"
-	app.errorResponse(w, r, http.StatusConflict, message)
+	app.errorResponse(w, r, http.StatusConflict, "edit_conflict", message)
+}
+
+// recordInUseResponse sends a JSON-formatted error message to the client with a 409 Conflict
+// status code when a record can't be purged because other records still refer to it.
+func (app *application) recordInUseResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the record is still referred to by placed orders and can't be purged"
+	app.errorResponse(w, r, http.StatusConflict, "record_in_use", message)
+}
+
+// permissionHeldByRoleResponse sends a JSON-formatted error message to the client with a 409
+// Conflict status code when a permission can't be revoked because a role of the member grants it.
+func (app *application) permissionHeldByRoleResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the permission is granted by one of the member's roles, change the roles to remove it"
+	app.errorResponse(w, r, http.StatusConflict, "permission_held_by_role", message)
+}
+
+// preconditionFailedResponse sends a JSON-formatted error message to the client with a 412
+// Precondition Failed status code when the If-Match header doesn't match the current version.
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the record has been changed since you last fetched it, please fetch it again"
+	app.errorResponse(w, r, http.StatusPreconditionFailed, "precondition_failed", message)
 }
 
 // invalidCredentialsResponse sends a JSON-formatted error with a 401 Unauthorized status code
 // to the client.
 func (app *application) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
 	message := "invalid authentication credentials"
-	app.errorResponse(w, r, http.StatusUnauthorized, message)
+	app.errorResponse(w, r, http.StatusUnauthorized, "invalid_credentials", message)
+}
+
+// rateLimitExceededResponse sends a JSON-formatted error with a 429 Too Many Requests status
+// code to the client.
+func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http.Request) {
+	message := "rate limit exceeded"
+	app.errorResponse(w, r, http.StatusTooManyRequests, "rate_limited", message)
+}
+
+// tooManyLoginAttemptsResponse sends a JSON-formatted error with a 429 Too Many Requests status
+// code and a Retry-After header telling the client when it may log in again.
+func (app *application) tooManyLoginAttemptsResponse(w http.ResponseWriter, r *http.Request, until time.Time) {
+	retryAfter := int(math.Ceil(time.Until(until).Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+
+	message := "too many failed login attempts, please try again later"
+	app.errorResponse(w, r, http.StatusTooManyRequests, "login_locked", message)
 }
 
 // invalidAuthenticationTokenResponse sends a JSON-formatted error with a 401 Unauthorized status
@@ -89,24 +150,31 @@ func (app *application) invalidAuthenticationTokenResponse(w http.ResponseWriter
 	w.Header().Set("WWWW-Authenticate", "Bearer")
 
 	message := "invalid or missing authentication token"
-	app.errorResponse(w, r, http.StatusUnauthorized, message)
+	app.errorResponse(w, r, http.StatusUnauthorized, "invalid_token", message)
+}
+
+// invalidApiKeyResponse sends a JSON-formatted error with a 401 Unauthorized status code to the
+// client.
+func (app *application) invalidApiKeyResponse(w http.ResponseWriter, r *http.Request) {
+	message := "invalid or expired API key"
+	app.errorResponse(w, r, http.StatusUnauthorized, "invalid_api_key", message)
 }
 
 // authenticationRequiredResponse sends a JSON-formatted error with a 401 Unauthorized status code
 // to the client.
 func (app *application) authenticationRequiredResponse(w http.ResponseWriter, r *http.Request) {
 	message := "you must be authenticated to access this resource"
-	app.errorResponse(w, r, http.StatusUnauthorized, message)
+	app.errorResponse(w, r, http.StatusUnauthorized, "authentication_required", message)
 }
 
 // inactiveAccountResponse sends a JSON-formatted error with a 403 Forbidden status code to the
 // client.
 func (app *application) inactiveAccountResponse(w http.ResponseWriter, r *http.Request) {
 	message := "your user account must be activated to access this resource"
-	app.errorResponse(w, r, http.StatusForbidden, message)
+	app.errorResponse(w, r, http.StatusForbidden, "inactive_account", message)
 }
 
 func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
 	message := "your user account doesn't have the necessary permissions to access this resource"
-	app.errorResponse(w, r, http.StatusForbidden, message)
+	app.errorResponse(w, r, http.StatusForbidden, "not_permitted", message)
 }
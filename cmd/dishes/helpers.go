@@ -1,15 +1,153 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
 	"net/url" // New import
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/shohin-cloud/dishes-api/pkg/dishes/model"
 	"github.com/shohin-cloud/dishes-api/pkg/dishes/validator"
 )
 
 type envelope map[string]interface{}
 
+// The background() helper runs fn in a background goroutine. Panics are recovered and logged
+// instead of crashing the server, and serve() waits for the goroutine before shutting down.
+func (app *application) background(fn func()) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.PrintError(fmt.Errorf("%s", err), nil)
+			}
+		}()
+
+		fn()
+	}()
+}
+
+// The clientIP() helper returns the IP address of the client. X-Forwarded-For is only believed
+// when the request comes from one of the -trusted-proxies; the address in front of the last
+// trusted proxy in the chain is used.
+func (app *application) clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	if !app.trustedProxy(ip) {
+		return ip
+	}
+
+	forwarded := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(forwarded[i])
+		if net.ParseIP(hop) == nil {
+			break
+		}
+
+		ip = hop
+		if !app.trustedProxy(hop) {
+			break
+		}
+	}
+
+	return ip
+}
+
+func (app *application) trustedProxy(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+
+	for _, network := range app.config.trustedProxies {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newRequestID returns a random ID for a request.
+func newRequestID() (string, error) {
+	b := make([]byte, 16)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// validRequestID reports whether id is short and only made of characters that are safe to log
+// and to echo in a header.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// The sessionMetadata() helper returns the client details stored with the tokens of a login
+// session.
+func (app *application) sessionMetadata(r *http.Request) model.SessionMetadata {
+	ip := app.clientIP(r)
+
+	userAgent := r.UserAgent()
+	if len(userAgent) > 256 {
+		userAgent = userAgent[:256]
+	}
+
+	return model.SessionMetadata{UserAgent: userAgent, IP: ip}
+}
+
+// The etag() helper returns the entity tag sent for the given record version.
+func etag(version int) string {
+	return strconv.Quote(strconv.Itoa(version))
+}
+
+// The ifMatch() helper reports whether the request may change a record at the given version.
+// Requests without an If-Match header always may; otherwise one of the listed entity tags, or
+// "*", has to match.
+func (app *application) ifMatch(r *http.Request, version int) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return true
+	}
+
+	current := etag(version)
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || tag == current {
+			return true
+		}
+	}
+
+	return false
+}
+
 // The readString() helper returns a string value from the query string, or the provided
 // default value if no matching key could be found.
 func (app *application) readString(qs url.Values, key string, defaultValue string) string {
@@ -59,3 +197,100 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	// Otherwise, return the converted integer value.
 	return i
 }
+
+// The readBool() helper reads a boolean value from the query string, accepting the values
+// understood by strconv.ParseBool. If no matching key could be found it returns the provided
+// default value, and if the value couldn't be parsed we record an error message in the
+// provided Validator instance.
+func (app *application) readBool(qs url.Values, key string, defaultValue bool, v *validator.Validator) bool {
+	s := qs.Get(key)
+	if s == "" {
+		return defaultValue
+	}
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return defaultValue
+	}
+	return b
+}
+
+// The readFloat() helper reads a string value from the query string and converts it to a
+// float64. It returns nil if no matching key could be found, so callers can tell a missing
+// value apart from zero. If the value couldn't be converted, then we record an error message
+// in the provided Validator instance.
+func (app *application) readFloat(qs url.Values, key string, v *validator.Validator) *float64 {
+	s := qs.Get(key)
+	if s == "" {
+		return nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		v.AddError(key, "must be a number")
+		return nil
+	}
+	return &f
+}
+
+// The readTime() helper reads an RFC 3339 timestamp or a plain YYYY-MM-DD date from the
+// query string. It returns nil if no matching key could be found, and records an error
+// message in the provided Validator instance if the value couldn't be parsed.
+func (app *application) readTime(qs url.Values, key string, v *validator.Validator) *time.Time {
+	s := qs.Get(key)
+	if s == "" {
+		return nil
+	}
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return &t
+		}
+	}
+	v.AddError(key, "must be a RFC 3339 timestamp or a YYYY-MM-DD date")
+	return nil
+}
+
+// The readIntCSV() helper reads a comma-separated list of integers from the query string,
+// e.g. ?ids=1,2,3. Values that aren't integers are recorded as an error in the provided
+// Validator instance.
+func (app *application) readIntCSV(qs url.Values, key string, v *validator.Validator) []int64 {
+	values := []int64{}
+	for _, s := range app.readCSV(qs, key, []string{}) {
+		i, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+		if err != nil {
+			v.AddError(key, "must be a comma-separated list of integers")
+			return []int64{}
+		}
+		values = append(values, i)
+	}
+	return values
+}
+
+// The readCatalogFilters() helper reads the narrowing filters shared by the dish, drink and
+// ingredient list endpoints into the given Filters. The legacy ?price= parameter is kept as an
+// alias for price_min.
+func (app *application) readCatalogFilters(qs url.Values, filters *model.Filters, v *validator.Validator) {
+	filters.PriceMin = app.readFloat(qs, "price_min", v)
+	if filters.PriceMin == nil {
+		filters.PriceMin = app.readFloat(qs, "price", v)
+	}
+	filters.PriceMax = app.readFloat(qs, "price_max", v)
+	filters.CreatedAfter = app.readTime(qs, "created_after", v)
+	filters.UpdatedBefore = app.readTime(qs, "updated_before", v)
+	filters.IDs = app.readIntCSV(qs, "ids", v)
+	filters.Contains = app.readString(qs, "contains", "")
+
+	// Keyset pagination is opt-in: any ?cursor= parameter, even an empty one for the first
+	// page, switches it on.
+	filters.UseCursor = qs.Has("cursor")
+	filters.Cursor = qs.Get("cursor")
+	filters.WithTotal = app.readBool(qs, "with_total", false, v)
+}
+
+// The rejectCursor() helper records a validation error when keyset pagination is requested
+// from a list endpoint that only supports page numbers, so the cursor isn't silently ignored.
+func (app *application) rejectCursor(qs url.Values, v *validator.Validator) {
+	for _, key := range []string{"cursor", "with_total"} {
+		v.Check(!qs.Has(key), key, "is only supported when listing dishes, drinks and ingredients")
+	}
+}
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/gorilla/mux"
 	"github.com/shohin-cloud/dishes-api/pkg/dishes/model"
+	"github.com/shohin-cloud/dishes-api/pkg/dishes/validator"
 )
 
 func (app *application) createIngredientHandler(w http.ResponseWriter, r *http.Request) {
@@ -16,7 +20,7 @@ func (app *application) createIngredientHandler(w http.ResponseWriter, r *http.R
 
 	err := app.readJSON(w, r, &input)
 	if err != nil {
-		app.respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		app.badRequestResponse(w, r, err)
 		return
 	}
 
@@ -26,13 +30,114 @@ func (app *application) createIngredientHandler(w http.ResponseWriter, r *http.R
 		DishID:   input.DishID,
 	}
 
+	v := validator.New()
+
+	if model.ValidateIngredient(v, ingredient); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
 	err = app.models.Ingredients.Insert(ingredient)
 	if err != nil {
-		app.respondWithError(w, http.StatusInternalServerError, "Failed to create ingredient")
+		switch {
+		case errors.Is(err, model.ErrDuplicateIngredientName):
+			v.AddError("name", "the dish already has an ingredient with this name")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, model.ErrInvalidIngredientDish):
+			v.AddError("dishId", "dish does not exist")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, model.AuditActionCreate, model.AuditEntityIngredient, ingredient.ID, nil, ingredient)
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/api/v1/ingredients/%s", ingredient.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"ingredient": ingredient}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) getAllIngredientsHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+	v := validator.New()
+
+	app.listIngredients(w, r, int64(app.readInt(qs, "dish_id", 0, v)), v)
+}
+
+// getDishIngredientsHandler lists the ingredients of the dish given in the URL.
+func (app *application) getDishIngredientsHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	param := vars["dishId"]
+
+	_, err := app.models.Dishes.GetById(param)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	dishID, err := strconv.ParseInt(param, 10, 64)
+	if err != nil {
+		app.notFoundResponse(w, r)
 		return
 	}
 
-	app.respondWithJson(w, http.StatusCreated, ingredient)
+	app.listIngredients(w, r, dishID, validator.New())
+}
+
+// listIngredients reads the common list parameters from the query string and writes a page of
+// ingredients, optionally restricted to a single dish.
+func (app *application) listIngredients(w http.ResponseWriter, r *http.Request, dishID int64, v *validator.Validator) {
+	var input struct {
+		Name string
+		model.Filters
+	}
+
+	qs := r.URL.Query()
+
+	input.Name = app.readString(qs, "name", "")
+	app.readCatalogFilters(qs, &input.Filters, v)
+
+	// Ingredients have no price, so the price filters are rejected rather than ignored.
+	for _, key := range []string{"price_min", "price_max", "price"} {
+		v.Check(!qs.Has(key), key, "is not supported for ingredients")
+	}
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "id")
+
+	input.Filters.SortSafelist = []string{
+		"id", "name", "quantity",
+		"-id", "-name", "-quantity",
+	}
+
+	if model.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	ingredients, metadata, err := app.models.Ingredients.GetAll(input.Name, dishID, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"ingredients": ingredients, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
 }
 
 func (app *application) getIngredientByIdHandler(w http.ResponseWriter, r *http.Request) {
@@ -41,10 +146,19 @@ func (app *application) getIngredientByIdHandler(w http.ResponseWriter, r *http.
 
 	ingredient, err := app.models.Ingredients.GetById(param)
 	if err != nil {
-		app.respondWithError(w, http.StatusNotFound, "Ingredient not found")
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
-	app.respondWithJson(w, http.StatusOK, ingredient)
+	w.Header().Set("ETag", etag(ingredient.Version))
+	err = app.writeJSON(w, http.StatusOK, envelope{"ingredient": ingredient}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
 }
 
 func (app *application) updateIngredientHandler(w http.ResponseWriter, r *http.Request) {
@@ -53,7 +167,19 @@ func (app *application) updateIngredientHandler(w http.ResponseWriter, r *http.R
 
 	ingredient, err := app.models.Ingredients.GetById(param)
 	if err != nil {
-		app.respondWithError(w, http.StatusNotFound, "Ingredient not found")
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	before := *ingredient
+
+	if !app.ifMatch(r, ingredient.Version) {
+		app.preconditionFailedResponse(w, r)
 		return
 	}
 
@@ -64,7 +190,7 @@ func (app *application) updateIngredientHandler(w http.ResponseWriter, r *http.R
 
 	err = app.readJSON(w, r, &input)
 	if err != nil {
-		app.respondWithError(w, http.StatusBadRequest, "Invalid request payload")
+		app.badRequestResponse(w, r, err)
 		return
 	}
 
@@ -75,24 +201,106 @@ func (app *application) updateIngredientHandler(w http.ResponseWriter, r *http.R
 		ingredient.Quantity = *input.Quantity
 	}
 
+	v := validator.New()
+
+	if model.ValidateIngredient(v, ingredient); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
 	err = app.models.Ingredients.Update(ingredient)
 	if err != nil {
-		app.respondWithError(w, http.StatusInternalServerError, "Failed to update ingredient")
+		switch {
+		case errors.Is(err, model.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, model.ErrDuplicateIngredientName):
+			v.AddError("name", "the dish already has an ingredient with this name")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
-	app.respondWithJson(w, http.StatusOK, ingredient)
+	app.audit(r, model.AuditActionUpdate, model.AuditEntityIngredient, ingredient.ID, &before, ingredient)
+
+	w.Header().Set("ETag", etag(ingredient.Version))
+	err = app.writeJSON(w, http.StatusOK, envelope{"ingredient": ingredient}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
 }
 
 func (app *application) deleteIngredientHandler(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	param := vars["ingredientId"]
 
-	err := app.models.Ingredients.Delete(param)
+	ingredient, err := app.models.Ingredients.GetById(param)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Ingredients.Delete(ingredient.ID)
 	if err != nil {
-		app.respondWithError(w, http.StatusInternalServerError, "Failed to delete ingredient")
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
-	app.respondWithJson(w, http.StatusOK, map[string]string{"message": "Ingredient deleted successfully"})
+	app.audit(r, model.AuditActionDelete, model.AuditEntityIngredient, ingredient.ID, ingredient, nil)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "ingredient moved to trash"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// restoreIngredientHandler takes an ingredient out of the trash. Its dish has to be restored
+// first if it is in the trash as well.
+func (app *application) restoreIngredientHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	param := vars["ingredientId"]
+
+	err := app.models.Ingredients.Restore(param)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, model.ErrDuplicateIngredientName):
+			v := validator.New()
+			v.AddError("name", "the dish already has an ingredient with this name")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, model.ErrInvalidIngredientDish):
+			v := validator.New()
+			v.AddError("dishId", "dish is in the trash")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	ingredient, err := app.models.Ingredients.GetById(param)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.audit(r, model.AuditActionRestore, model.AuditEntityIngredient, ingredient.ID, nil, ingredient)
+
+	w.Header().Set("ETag", etag(ingredient.Version))
+	err = app.writeJSON(w, http.StatusOK, envelope{"ingredient": ingredient}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
 }
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shohin-cloud/dishes-api/pkg/dishes/model"
+	"github.com/shohin-cloud/dishes-api/pkg/jwt"
+)
+
+// denylist is the in-memory copy of the revoked_tokens table, so signed tokens can be checked
+// without a database round-trip. Revocations made by this instance are visible immediately,
+// those of other instances after the next sync.
+type denylist struct {
+	mu  sync.RWMutex
+	ids map[string]time.Time
+}
+
+func (d *denylist) contains(id string) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	expiry, ok := d.ids[id]
+	return ok && time.Now().Before(expiry)
+}
+
+func (d *denylist) add(id string, expiry time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.ids[id] = expiry
+}
+
+func (d *denylist) replace(ids map[string]time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.ids = ids
+}
+
+// newJWTKey loads the signing key for the jwt authentication mode.
+func newJWTKey(cfg config) (*jwt.Key, error) {
+	var key *jwt.Key
+
+	switch cfg.auth.jwt.alg {
+	case jwt.AlgHS256:
+		secret := cfg.auth.jwt.secret
+		if cfg.auth.jwt.secretFile != "" {
+			data, err := os.ReadFile(cfg.auth.jwt.secretFile)
+			if err != nil {
+				return nil, err
+			}
+			secret = strings.TrimSpace(string(data))
+		}
+
+		var err error
+		key, err = jwt.NewHMACKey([]byte(secret))
+		if err != nil {
+			return nil, err
+		}
+	case jwt.AlgEdDSA:
+		if cfg.auth.jwt.keyFile == "" {
+			return nil, errors.New("-jwt-key-file is required for EdDSA")
+		}
+
+		var err error
+		key, err = jwt.LoadEd25519Key(cfg.auth.jwt.keyFile)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, errors.New("-jwt-alg must be HS256 or EdDSA")
+	}
+
+	key.Issuer = cfg.auth.jwt.issuer
+
+	return key, nil
+}
+
+// syncDenylist reloads the denylist from the database at the given interval and clears out
+// expired entries. It runs for the lifetime of the process.
+func (app *application) syncDenylist(interval time.Duration) {
+	for range time.Tick(interval) {
+		err := app.models.Revoked.DeleteExpired()
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+
+		ids, err := app.models.Revoked.GetAllActive()
+		if err != nil {
+			app.logger.PrintError(err, nil)
+			continue
+		}
+
+		app.denylist.replace(ids)
+	}
+}
+
+// revokeSignedToken denylists a JWT ID or session ID until the given expiry.
+func (app *application) revokeSignedToken(id string, expiry time.Time) error {
+	err := app.models.Revoked.Insert(id, expiry)
+	if err != nil {
+		return err
+	}
+
+	app.denylist.add(id, expiry)
+
+	return nil
+}
+
+// revokeSession ends a session of a member. Its refresh token is deleted and, in jwt mode, the
+// session is denylisted so signed tokens issued for it stop working as well.
+func (app *application) revokeSession(memberID int64, session string) error {
+	err := app.models.Tokens.DeleteSession(memberID, session)
+	if err != nil {
+		return err
+	}
+
+	if app.jwtKey == nil {
+		return nil
+	}
+
+	return app.revokeSignedToken(session, time.Now().Add(authenticationTokenTTL))
+}
+
+// revokeSignedSessions denylists every session of a member in jwt mode, e.g. after a password
+// reset. Database tokens are deleted by the caller.
+func (app *application) revokeSignedSessions(memberID int64) error {
+	if app.jwtKey == nil {
+		return nil
+	}
+
+	sessions, err := app.models.Tokens.GetSessionsForMember(memberID, "")
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		err = app.revokeSignedToken(session.ID, time.Now().Add(authenticationTokenTTL))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// revokeSignedSessionsForPermissions logs a member out in jwt mode after their permissions
+// were taken away or they were deactivated, since signed tokens keep the claims they were
+// issued with until they expire. In the tokens mode permissions are read from the database on every request, so the
+// sessions are left alone.
+func (app *application) revokeSignedSessionsForPermissions(memberID int64) error {
+	if app.jwtKey == nil {
+		return nil
+	}
+
+	err := app.revokeSignedSessions(memberID)
+	if err != nil {
+		return err
+	}
+
+	for _, scope := range []string{model.ScopeAuthentication, model.ScopeRefresh} {
+		err = app.models.Tokens.DeleteAllForMember(scope, memberID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// newAuthenticationToken issues the authentication token for a session: a database token, or
+// a signed token carrying the member's details and permissions in jwt mode.
+func (app *application) newAuthenticationToken(member *model.Member, refresh *model.Token) (*model.Token, error) {
+	if app.jwtKey == nil {
+		return app.models.Tokens.NewForSession(refresh, authenticationTokenTTL)
+	}
+
+	permissions, err := app.models.Permissions.GetAllForMember(member.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	expiry := time.Now().Add(authenticationTokenTTL)
+
+	claims := &jwt.Claims{
+		Subject:     strconv.FormatInt(member.ID, 10),
+		ExpiresAt:   expiry.Unix(),
+		Session:     refresh.Session,
+		Name:        member.Name,
+		Email:       member.Email,
+		Activated:   member.Activated,
+		Permissions: permissions,
+	}
+
+	signed, err := app.jwtKey.Sign(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &model.Token{
+		Plaintext: signed,
+		MemberID:  member.ID,
+		Expiry:    time.Unix(claims.ExpiresAt, 0),
+		Scope:     model.ScopeAuthentication,
+		Session:   refresh.Session,
+	}, nil
+}
+
+// memberForSignedToken verifies a JWT and builds the member from its claims.
+func (app *application) memberForSignedToken(token string) (*model.Member, *jwt.Claims, error) {
+	claims, err := app.jwtKey.Verify(token, time.Now())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if app.denylist.contains(claims.ID) || app.denylist.contains(claims.Session) {
+		return nil, nil, jwt.ErrInvalidToken
+	}
+
+	id, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		return nil, nil, jwt.ErrInvalidToken
+	}
+
+	member := &model.Member{
+		ID:          id,
+		Name:        claims.Name,
+		Email:       claims.Email,
+		Activated:   claims.Activated,
+		Permissions: model.Permissions(claims.Permissions),
+	}
+
+	return member, claims, nil
+}
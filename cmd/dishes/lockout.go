@@ -0,0 +1,231 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shohin-cloud/dishes-api/pkg/dishes/model"
+	"github.com/shohin-cloud/dishes-api/pkg/dishes/validator"
+)
+
+// loginGuardTTL is how long a lock seen in the database is trusted from memory. It bounds how
+// long an unlock made on another instance takes to show up here.
+const loginGuardTTL = 30 * time.Second
+
+// loginGuard remembers recent login locks, so a client hammering a locked email or IP address
+// is turned away without a database round-trip.
+type loginGuard struct {
+	mu    sync.Mutex
+	locks map[string]loginLock
+}
+
+type loginLock struct {
+	until     time.Time
+	checkedAt time.Time
+}
+
+func newLoginGuard() *loginGuard {
+	return &loginGuard{locks: make(map[string]loginLock)}
+}
+
+// lockedUntil returns the remembered lock of a key. The second return value is false if the
+// database has to be asked.
+func (g *loginGuard) lockedUntil(key string) (time.Time, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	lock, ok := g.locks[key]
+	if !ok {
+		return time.Time{}, false
+	}
+
+	now := time.Now()
+	if now.After(lock.until) || now.Sub(lock.checkedAt) > loginGuardTTL {
+		delete(g.locks, key)
+		return time.Time{}, false
+	}
+
+	return lock.until, true
+}
+
+func (g *loginGuard) set(key string, until time.Time) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.locks[key] = loginLock{until: until, checkedAt: time.Now()}
+}
+
+func (g *loginGuard) clear(key string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	delete(g.locks, key)
+}
+
+// loginKey is something failed logins are counted for, with the number of failures after
+// which it gets locked.
+type loginKey struct {
+	key         string
+	maxAttempts int
+}
+
+func emailLoginKey(email string) string {
+	return "email:" + strings.ToLower(email)
+}
+
+// loginKeys returns the keys a login attempt is counted for: the email address, which stops
+// guessing the password of one account, and the client IP address, which stops trying one
+// password on many accounts.
+func (app *application) loginKeys(email, ip string) []loginKey {
+	return []loginKey{
+		{key: emailLoginKey(email), maxAttempts: app.config.login.maxAttempts},
+		{key: "ip:" + ip, maxAttempts: app.config.login.maxAttemptsIP},
+	}
+}
+
+// loginLockedUntil returns the time until which logins for any of the keys are locked, or the
+// zero time if none of them is.
+func (app *application) loginLockedUntil(keys []loginKey) (time.Time, error) {
+	var until time.Time
+
+	for _, k := range keys {
+		lockedUntil, ok := app.logins.lockedUntil(k.key)
+		if !ok {
+			attempt, err := app.models.Logins.Get(k.key)
+			if err != nil {
+				return time.Time{}, err
+			}
+
+			if attempt.LockedUntil == nil || attempt.LockedUntil.Before(time.Now()) {
+				continue
+			}
+
+			lockedUntil = *attempt.LockedUntil
+			app.logins.set(k.key, lockedUntil)
+		}
+
+		if lockedUntil.After(until) {
+			until = lockedUntil
+		}
+	}
+
+	return until, nil
+}
+
+// recordLoginFailure counts a failed login for every key. Once a key reaches its threshold it
+// is locked, for twice as long with each further failure, up to -login-max-lockout.
+func (app *application) recordLoginFailure(keys []loginKey) error {
+	for _, k := range keys {
+		attempt, err := app.models.Logins.RecordFailure(k.key)
+		if err != nil {
+			return err
+		}
+
+		if attempt.Failures < k.maxAttempts {
+			continue
+		}
+
+		lockout := app.config.login.maxLockout
+		if shift := attempt.Failures - k.maxAttempts; shift < 20 {
+			lockout = min(app.config.login.lockout<<shift, app.config.login.maxLockout)
+		}
+
+		until := time.Now().Add(lockout)
+
+		err = app.models.Logins.Lock(k.key, until)
+		if err != nil {
+			return err
+		}
+
+		app.logins.set(k.key, until)
+
+		app.logger.PrintInfo("login locked", map[string]string{
+			"key":          k.key,
+			"failures":     strconv.Itoa(attempt.Failures),
+			"locked_until": until.Format(time.RFC3339),
+		})
+	}
+
+	return nil
+}
+
+// resetLoginFailures forgets the failed logins counted for the keys, e.g. after a successful
+// login or when an admin unlocks an account.
+func (app *application) resetLoginFailures(keys []loginKey) error {
+	for _, k := range keys {
+		err := app.models.Logins.Reset(k.key)
+		if err != nil {
+			return err
+		}
+
+		app.logins.clear(k.key)
+	}
+
+	return nil
+}
+
+// checkCurrentPassword confirms the password of the authenticated member before a sensitive
+// change, counting wrong guesses against the same lockout as logins so a stolen session can't
+// be used to brute-force the password. It sends the error response itself, reporting a wrong
+// password on the given field, and returns false if the change must not go ahead.
+func (app *application) checkCurrentPassword(w http.ResponseWriter, r *http.Request, member *model.Member, plaintext, field string) bool {
+	keys := app.loginKeys(member.Email, app.sessionMetadata(r).IP)
+
+	lockedUntil, err := app.loginLockedUntil(keys)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+
+	if !lockedUntil.IsZero() {
+		app.tooManyLoginAttemptsResponse(w, r, lockedUntil)
+		return false
+	}
+
+	match, err := member.Password.Matches(plaintext)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+
+	if !match {
+		err = app.recordLoginFailure(keys)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return false
+		}
+
+		v := validator.New()
+		v.AddError(field, "is incorrect")
+		app.failedValidationResponse(w, r, v.Errors)
+		return false
+	}
+
+	// As with logins, only the email is cleared.
+	err = app.resetLoginFailures([]loginKey{{key: emailLoginKey(member.Email)}})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+
+	return true
+}
+
+// purgeLoginAttempts deletes the failed logins that are no longer counted and whose lock has
+// ended, checking every interval.
+func (app *application) purgeLoginAttempts(interval time.Duration) {
+	for range time.Tick(interval) {
+		purged, err := app.models.Logins.DeleteExpired()
+		if err != nil {
+			app.logger.PrintError(err, nil)
+			continue
+		}
+
+		if purged > 0 {
+			app.logger.PrintInfo("login attempts purged", map[string]string{
+				"keys": strconv.FormatInt(purged, 10),
+			})
+		}
+	}
+}
@@ -55,27 +55,37 @@ func (app *application) registerMemberHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	err = app.models.Permissions.AddForMember(member.ID, "dishes:read")
+	err = app.models.Permissions.SetRoles(member.ID, model.RoleCustomer)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
+	app.audit(r, model.AuditActionCreate, model.AuditEntityMember, member.ID, nil, member)
+
 	token, err := app.models.Tokens.New(member.ID, 3*24*time.Hour, model.ScopeActivation)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	var res struct {
-		Token  *string       `json:"token"`
-		Member *model.Member `json:"member"`
-	}
+	app.background(func() {
+		data := map[string]interface{}{
+			"Name":            member.Name,
+			"MemberID":        member.ID,
+			"ActivationToken": token.Plaintext,
+		}
 
-	res.Token = &token.Plaintext
-	res.Member = member
+		err := app.mailer.Send(member.Email, "member_welcome.tmpl", data)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
 
-	app.writeJSON(w, http.StatusCreated, envelope{"member": res}, nil)
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"member": member}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
 }
 
 func (app *application) activateMemberHandler(w http.ResponseWriter, r *http.Request) {
@@ -108,6 +118,7 @@ func (app *application) activateMemberHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	before := *member
 	member.Activated = true
 
 	err = app.models.Members.Update(member)
@@ -127,8 +138,334 @@ func (app *application) activateMemberHandler(w http.ResponseWriter, r *http.Req
 		return
 	}
 
+	app.audit(r, model.AuditActionActivate, model.AuditEntityMember, member.ID, &before, member)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"member": member}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateMemberPasswordHandler sets a new password using a password reset token. Every
+// existing session of the member is revoked afterwards.
+func (app *application) updateMemberPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Password       string `json:"password"`
+		TokenPlaintext string `json:"token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	model.ValidatePasswordPlaintext(v, input.Password)
+	model.ValidateTokenPlaintext(v, input.TokenPlaintext)
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	member, err := app.models.Members.GetForToken(model.ScopePasswordReset, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired password reset token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = member.Password.Set(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Update bumps member.Version, so a concurrent change of the member is reported as an
+	// edit conflict instead of being overwritten.
+	err = app.models.Members.Update(member)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.revokeSignedSessions(member.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	for _, scope := range []string{model.ScopePasswordReset, model.ScopeAuthentication, model.ScopeRefresh} {
+		err = app.models.Tokens.DeleteAllForMember(scope, member.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	app.audit(r, model.AuditActionResetPassword, model.AuditEntityMember, member.ID, nil, nil)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "your password was successfully reset"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getCurrentMember loads the authenticated member from the database. Members authenticated
+// with a signed token only carry the claims of the token, so the record is always re-read.
+func (app *application) getCurrentMember(w http.ResponseWriter, r *http.Request) *model.Member {
+	member, err := app.models.Members.GetByID(app.contextGetMember(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil
+	}
+
+	return member
+}
+
+func (app *application) showCurrentMemberHandler(w http.ResponseWriter, r *http.Request) {
+	member := app.getCurrentMember(w, r)
+	if member == nil {
+		return
+	}
+
+	err := app.writeJSON(w, http.StatusOK, envelope{"member": member}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// updateCurrentMemberHandler changes the name and email of the authenticated member. A new
+// email address has to be verified again: the member is deactivated and receives a fresh
+// activation token at the new address. In jwt mode their sessions end as well, since signed
+// tokens would otherwise keep claiming an activated member until they expire.
+func (app *application) updateCurrentMemberHandler(w http.ResponseWriter, r *http.Request) {
+	member := app.getCurrentMember(w, r)
+	if member == nil {
+		return
+	}
+
+	var input struct {
+		Name  *string `json:"name"`
+		Email *string `json:"email"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	before := *member
+
+	if input.Name != nil {
+		member.Name = *input.Name
+	}
+
+	emailChanged := input.Email != nil && *input.Email != member.Email
+	if emailChanged {
+		member.Email = *input.Email
+		member.Activated = false
+	}
+
+	v := validator.New()
+
+	if model.ValidateMember(v, member); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Members.Update(member)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrDuplicateEmail):
+			v.AddError("email", "a member with this email address already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, model.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if emailChanged {
+		err = app.revokeSignedSessionsForPermissions(member.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		err = app.models.Tokens.DeleteAllForMember(model.ScopeActivation, member.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		token, err := app.models.Tokens.New(member.ID, 3*24*time.Hour, model.ScopeActivation)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		app.background(func() {
+			data := map[string]interface{}{
+				"Name":            member.Name,
+				"ActivationToken": token.Plaintext,
+			}
+
+			err := app.mailer.Send(member.Email, "email_change.tmpl", data)
+			if err != nil {
+				app.logger.PrintError(err, nil)
+			}
+		})
+	}
+
+	app.audit(r, model.AuditActionUpdate, model.AuditEntityMember, member.ID, &before, member)
+
 	err = app.writeJSON(w, http.StatusOK, envelope{"member": member}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+// changeCurrentMemberPasswordHandler sets a new password for the authenticated member after
+// checking the current one.
+func (app *application) changeCurrentMemberPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	member := app.getCurrentMember(w, r)
+	if member == nil {
+		return
+	}
+
+	var input struct {
+		CurrentPassword string `json:"current_password"`
+		Password        string `json:"password"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	v.Check(input.CurrentPassword != "", "current_password", "must be provided")
+	if model.ValidatePasswordPlaintext(v, input.Password); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.checkCurrentPassword(w, r, member, input.CurrentPassword, "current_password") {
+		return
+	}
+
+	err = member.Password.Set(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Members.Update(member)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Tokens.DeleteAllForMember(model.ScopePasswordReset, member.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Whoever else is logged in as the member has to log in again with the new password.
+	err = app.revokeOtherSessions(r, member.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.audit(r, model.AuditActionChangePassword, model.AuditEntityMember, member.ID, nil, nil)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "your password was successfully changed"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteCurrentMemberHandler deletes the authenticated member's account after confirming their
+// password. All of the member's tokens go with it.
+func (app *application) deleteCurrentMemberHandler(w http.ResponseWriter, r *http.Request) {
+	member := app.getCurrentMember(w, r)
+	if member == nil {
+		return
+	}
+
+	var input struct {
+		Password string `json:"password"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if v.Check(input.Password != "", "password", "must be provided"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.checkCurrentPassword(w, r, member, input.Password, "password") {
+		return
+	}
+
+	// Signed tokens aren't stored, so they have to be denylisted before the sessions are gone.
+	err = app.revokeSignedSessions(member.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Members.Delete(member.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, model.AuditActionDelete, model.AuditEntityMember, member.ID, member, nil)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "your account was successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
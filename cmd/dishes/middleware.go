@@ -1,17 +1,126 @@
 package main
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"math"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/shohin-cloud/dishes-api/pkg/dishes/model"
 	"github.com/shohin-cloud/dishes-api/pkg/dishes/validator"
+	"github.com/shohin-cloud/dishes-api/pkg/jwt"
+	"golang.org/x/time/rate"
 )
 
+// requestID gives every request an ID, sent back in the X-Request-ID header and included in
+// error responses and error logs. The ID of a request coming from one of the -trusted-proxies
+// is kept, so that the same ID can be followed through the proxy logs.
+func (app *application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			ip = r.RemoteAddr
+		}
+
+		if !app.trustedProxy(ip) || !validRequestID(id) {
+			id, err = newRequestID()
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+
+		w.Header().Set("X-Request-ID", id)
+
+		next.ServeHTTP(w, app.contextSetRequestID(r, id))
+	})
+}
+
+// recoverPanic turns a panic in a later handler into a 500 Internal Server Error response,
+// instead of Go's default of dropping the connection. The panic is logged with its stack trace
+// by serverErrorResponse.
+func (app *application) recoverPanic(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if err := recover(); err != nil {
+				// http.ErrAbortHandler is used on purpose to abort a response; let the server
+				// handle it as usual.
+				if err == http.ErrAbortHandler {
+					panic(err)
+				}
+
+				w.Header().Set("Connection", "close")
+				app.serverErrorResponse(w, r, fmt.Errorf("%s", err))
+			}
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// enableCORS lets browsers on the -cors-trusted-origins call the API. Preflight requests are
+// answered here, before they reach the router, which would reject OPTIONS as not allowed.
+func (app *application) enableCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Origin")
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+
+		origin := r.Header.Get("Origin")
+
+		if origin != "" {
+			for i := range app.config.cors.trustedOrigins {
+				if origin != app.config.cors.trustedOrigins[i] {
+					continue
+				}
+
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Access-Control-Expose-Headers", "ETag, Location, Retry-After, X-RateLimit-Limit, X-RateLimit-Remaining, X-RateLimit-Reset, X-Request-ID")
+
+				if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+					w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, PUT, PATCH, DELETE")
+					w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, If-Match, X-API-Key")
+					w.Header().Set("Access-Control-Max-Age", "600")
+
+					w.WriteHeader(http.StatusOK)
+					return
+				}
+
+				break
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (app *application) authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Vary", "Authorization")
+		w.Header().Add("Vary", "X-API-Key")
+		if key := r.Header.Get("X-API-Key"); key != "" {
+			member, apiKey, err := app.memberForApiKey(key)
+			if err != nil {
+				switch {
+				case errors.Is(err, model.ErrRecordNotFound):
+					app.invalidApiKeyResponse(w, r)
+				default:
+					app.serverErrorResponse(w, r, err)
+				}
+				return
+			}
+			r = app.contextSetMember(r, member)
+			r = app.contextSetApiKey(r, apiKey)
+			next.ServeHTTP(w, r)
+			return
+		}
 		authorizationHeader := r.Header.Get("Authorization")
 		if authorizationHeader == "" {
 			r = app.contextSetMember(r, model.AnonymousMember)
@@ -24,6 +133,18 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			return
 		}
 		token := headerParts[1]
+		if app.jwtKey != nil && jwt.IsToken(token) {
+			member, claims, err := app.memberForSignedToken(token)
+			if err != nil {
+				app.invalidAuthenticationTokenResponse(w, r)
+				return
+			}
+			r = app.contextSetMember(r, member)
+			r = app.contextSetToken(r, token)
+			r = app.contextSetClaims(r, claims)
+			next.ServeHTTP(w, r)
+			return
+		}
 		v := validator.New()
 		if model.ValidateTokenPlaintext(v, token); !v.Valid() {
 			app.invalidAuthenticationTokenResponse(w, r)
@@ -39,11 +160,107 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			}
 			return
 		}
+		err = app.models.Tokens.Touch(token, app.sessionMetadata(r))
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
 		r = app.contextSetMember(r, member)
+		r = app.contextSetToken(r, token)
 		next.ServeHTTP(w, r)
 	})
 }
 
+// rateLimit gives every client a token bucket refilled at -limiter-rps requests per second
+// and holding up to -limiter-burst requests. keyFor names the bucket of a request; requests it
+// returns "" for aren't limited. Clients which haven't been seen for a while are
+// forgotten until ctx is done.
+func (app *application) rateLimit(ctx context.Context, keyFor func(*http.Request) string, next http.Handler) http.Handler {
+	if !app.config.limiter.enabled {
+		return next
+	}
+
+	type client struct {
+		limiter  *rate.Limiter
+		lastSeen time.Time
+	}
+
+	var (
+		mu      sync.Mutex
+		clients = make(map[string]*client)
+	)
+
+	// Forget clients which haven't been seen for a while so the map doesn't grow forever.
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			mu.Lock()
+			for key, client := range clients {
+				if time.Since(client.lastSeen) > 3*time.Minute {
+					delete(clients, key)
+				}
+			}
+			mu.Unlock()
+		}
+	}()
+
+	rps := app.config.limiter.rps
+	burst := app.config.limiter.burst
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := keyFor(r)
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		mu.Lock()
+		if _, found := clients[key]; !found {
+			clients[key] = &client{limiter: rate.NewLimiter(rate.Limit(rps), burst)}
+		}
+		c := clients[key]
+		c.lastSeen = time.Now()
+		allowed := c.limiter.Allow()
+		tokens := math.Max(c.limiter.Tokens(), 0)
+		mu.Unlock()
+
+		w.Header().Set("X-RateLimit-Limit", strconv.Itoa(burst))
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(int(tokens)))
+		w.Header().Set("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil((float64(burst)-tokens)/rps))))
+
+		if !allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil((1-tokens)/rps))))
+			app.rateLimitExceededResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ipRateLimitKey limits every request by IP address. It runs before authenticate, so guessing
+// authentication tokens and API keys is limited too.
+func (app *application) ipRateLimitKey(r *http.Request) string {
+	return "ip:" + app.clientIP(r)
+}
+
+// memberRateLimitKey additionally limits authenticated members by member ID, however many
+// addresses they use. It has to run after authenticate.
+func (app *application) memberRateLimitKey(r *http.Request) string {
+	if member := app.contextGetMember(r); !member.IsAnonymous() {
+		return fmt.Sprintf("member:%d", member.ID)
+	}
+	return ""
+}
+
 func (app *application) requireActivatedMember(next http.HandlerFunc) http.HandlerFunc {
 	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		member := app.contextGetMember(r)
@@ -67,15 +284,27 @@ func (app *application) requireAuthenticatedMember(next http.HandlerFunc) http.H
 	})
 }
 
+// rejectApiKeys refuses requests authenticated with an API key, so a key can't be used to
+// create or revoke other keys.
+func (app *application) rejectApiKeys(next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.contextGetApiKey(r) != nil {
+			app.notPermittedResponse(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (app *application) requirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
 	fn := func(w http.ResponseWriter, r *http.Request) {
 		member := app.contextGetMember(r)
-		permissions, err := app.models.Permissions.GetAllForMember(member.ID)
+		permitted, err := app.memberHasPermission(member, code)
 		if err != nil {
 			app.serverErrorResponse(w, r, err)
 			return
 		}
-		if !permissions.Include(code) {
+		if !permitted {
 			app.notPermittedResponse(w, r)
 			return
 		}
@@ -83,3 +312,64 @@ func (app *application) requirePermission(code string, next http.HandlerFunc) ht
 	}
 	return app.requireActivatedMember(fn)
 }
+
+// requireRole requires the member to hold the given role. Roles aren't part of signed tokens,
+// so they are always looked up in the database.
+func (app *application) requireRole(role string, next http.HandlerFunc) http.HandlerFunc {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		member := app.contextGetMember(r)
+		roles, err := app.models.Permissions.GetRolesForMember(member.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		for _, code := range roles {
+			if code == role {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		app.notPermittedResponse(w, r)
+	}
+	return app.requireActivatedMember(fn)
+}
+
+// requireReadPermission guards read-only routes. When anonymous reads are enabled the route
+// is open to everyone, otherwise it requires the given permission like requirePermission.
+func (app *application) requireReadPermission(code string, next http.HandlerFunc) http.HandlerFunc {
+	if app.config.anonymousReads {
+		return next
+	}
+	return app.requirePermission(code, next)
+}
+
+// requireReadMember guards read-only routes whose handler checks the read permissions itself.
+// When anonymous reads are enabled the route is open to everyone, otherwise it requires an
+// activated member.
+func (app *application) requireReadMember(next http.HandlerFunc) http.HandlerFunc {
+	if app.config.anonymousReads {
+		return next
+	}
+	return app.requireActivatedMember(next)
+}
+
+// memberPermissions returns the permission codes of the member, taken from the signed token
+// the member authenticated with when there is one.
+func (app *application) memberPermissions(member *model.Member) (model.Permissions, error) {
+	if member.IsAnonymous() {
+		return model.Permissions{}, nil
+	}
+	if member.Permissions != nil {
+		return member.Permissions, nil
+	}
+	return app.models.Permissions.GetAllForMember(member.ID)
+}
+
+// memberHasPermission reports whether the member has been granted the given permission code.
+func (app *application) memberHasPermission(member *model.Member, code string) (bool, error) {
+	permissions, err := app.memberPermissions(member)
+	if err != nil {
+		return false, err
+	}
+	return permissions.Include(code), nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/shohin-cloud/dishes-api/pkg/jsonlog"
+)
+
+func TestRecoverPanic(t *testing.T) {
+	app := &application{
+		logger: jsonlog.NewLogger(io.Discard, jsonlog.LevelInfo),
+	}
+
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+	}{
+		{
+			name: "missing member in context",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				app.contextGetMember(r)
+			},
+		},
+		{
+			name: "panic with an error",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				panic(errors.New("unexpected state"))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+			app.recoverPanic(tt.handler).ServeHTTP(rr, r)
+
+			rs := rr.Result()
+
+			if rs.StatusCode != http.StatusInternalServerError {
+				t.Errorf("got status %d; want %d", rs.StatusCode, http.StatusInternalServerError)
+			}
+
+			if got := rs.Header.Get("Connection"); got != "close" {
+				t.Errorf("got Connection header %q; want %q", got, "close")
+			}
+
+			if got := rs.Header.Get("Content-Type"); got != "application/json" {
+				t.Errorf("got Content-Type header %q; want %q", got, "application/json")
+			}
+
+			var body struct {
+				Error apiError `json:"error"`
+			}
+
+			err := json.NewDecoder(rs.Body).Decode(&body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if body.Error.Code != "internal_error" {
+				t.Errorf("got error code %q; want %q", body.Error.Code, "internal_error")
+			}
+		})
+	}
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/shohin-cloud/dishes-api/pkg/dishes/model"
+	"github.com/shohin-cloud/dishes-api/pkg/dishes/validator"
+)
+
+// writeOrder loads the items of an order and sends it to the client under the given key.
+func (app *application) writeOrder(w http.ResponseWriter, r *http.Request, status int, key string, order *model.Order, headers http.Header) {
+	items, err := app.models.OrderItems.GetAllForOrder(order.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	order.Items = items
+	if order.Status == model.OrderStatusCart {
+		order.Total = model.ItemsTotal(items)
+	}
+
+	err = app.writeJSON(w, status, envelope{key: order}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) getCartHandler(w http.ResponseWriter, r *http.Request) {
+	member := app.contextGetMember(r)
+
+	cart, err := app.models.Orders.GetOrCreateCart(member.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeOrder(w, r, http.StatusOK, "cart", cart, nil)
+}
+
+func (app *application) addCartItemHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		DishID   string `json:"dishId"`
+		DrinkID  string `json:"drinkId"`
+		Quantity int    `json:"quantity"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	item := &model.OrderItem{
+		DishID:   input.DishID,
+		DrinkID:  input.DrinkID,
+		Quantity: input.Quantity,
+	}
+
+	v := validator.New()
+
+	if model.ValidateOrderItem(v, item); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	member := app.contextGetMember(r)
+
+	cart, err := app.models.Orders.GetOrCreateCart(member.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	item.OrderID = cart.ID
+
+	err = app.models.OrderItems.Insert(item)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrInvalidOrderItemTarget):
+			if item.DishID != "" {
+				v.AddError("dishId", "dish does not exist")
+			} else {
+				v.AddError("drinkId", "drink does not exist")
+			}
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, model.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeOrder(w, r, http.StatusCreated, "cart", cart, nil)
+}
+
+// getCartItem looks up an item of the authenticated member's cart. It sends the error
+// response itself and returns nil if the item can't be used.
+func (app *application) getCartItem(w http.ResponseWriter, r *http.Request) (*model.Order, *model.OrderItem) {
+	member := app.contextGetMember(r)
+
+	cart, err := app.models.Orders.GetOrCreateCart(member.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, nil
+	}
+
+	item, err := app.models.OrderItems.GetById(mux.Vars(r)["itemId"])
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, nil
+	}
+
+	// Items of other carts and of placed orders are treated as missing.
+	if item.OrderID != cart.ID {
+		app.notFoundResponse(w, r)
+		return nil, nil
+	}
+
+	return cart, item
+}
+
+func (app *application) updateCartItemHandler(w http.ResponseWriter, r *http.Request) {
+	cart, item := app.getCartItem(w, r)
+	if item == nil {
+		return
+	}
+
+	var input struct {
+		Quantity *int `json:"quantity"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Quantity != nil {
+		item.Quantity = *input.Quantity
+	}
+
+	v := validator.New()
+
+	if model.ValidateOrderItem(v, item); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.OrderItems.UpdateQuantity(item)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeOrder(w, r, http.StatusOK, "cart", cart, nil)
+}
+
+func (app *application) deleteCartItemHandler(w http.ResponseWriter, r *http.Request) {
+	cart, item := app.getCartItem(w, r)
+	if item == nil {
+		return
+	}
+
+	err := app.models.OrderItems.Delete(item.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeOrder(w, r, http.StatusOK, "cart", cart, nil)
+}
+
+// createOrderHandler places the authenticated member's cart as a new pending order.
+func (app *application) createOrderHandler(w http.ResponseWriter, r *http.Request) {
+	member := app.contextGetMember(r)
+
+	order, err := app.models.Orders.GetOrCreateCart(member.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Orders.Checkout(order)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrEmptyCart):
+			v := validator.New()
+			v.AddError("cart", "must contain at least one item")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, model.ErrTrashedCartItem):
+			v := validator.New()
+			v.AddError("cart", "contains items that are no longer available")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, model.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	items, err := app.models.OrderItems.GetAllForOrder(order.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	order.Items = items
+
+	app.background(func() {
+		data := map[string]interface{}{
+			"Name":  member.Name,
+			"Order": order,
+		}
+
+		err := app.mailer.Send(member.Email, "order_confirmation.tmpl", data)
+		if err != nil {
+			app.logger.PrintError(err, nil)
+		}
+	})
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/api/v1/orders/%s", order.ID))
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"order": order}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getAllOrdersHandler lists the orders of the authenticated member. Staff holding
+// orders:manage see the orders of every member instead, optionally narrowed down to one.
+func (app *application) getAllOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		MemberID int64
+		Status   string
+		model.Filters
+	}
+
+	member := app.contextGetMember(r)
+
+	permissions, err := app.memberPermissions(member)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	if permissions.Include("orders:manage") {
+		input.MemberID = int64(app.readInt(qs, "member_id", 0, v))
+		v.Check(input.MemberID >= 0, "member_id", "must be a positive integer")
+	} else {
+		if qs.Has("member_id") {
+			app.notPermittedResponse(w, r)
+			return
+		}
+		input.MemberID = member.ID
+	}
+
+	input.Status = app.readString(qs, "status", "")
+	if input.Status != "" {
+		model.ValidateOrderStatus(v, input.Status)
+	}
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	app.rejectCursor(qs, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "-id")
+
+	input.Filters.SortSafelist = []string{
+		"id", "total",
+		"-id", "-total",
+	}
+
+	if model.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	orders, metadata, err := app.models.Orders.GetAll(input.MemberID, input.Status, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"orders": orders, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// getOrder looks up the order from the URL and makes sure the authenticated member may see
+// it: either they placed it, or they are staff holding the orders:manage permission. The
+// second return value tells whether the member is staff. It sends the error response itself
+// and returns nil if the order can't be used.
+func (app *application) getOrder(w http.ResponseWriter, r *http.Request) (*model.Order, bool) {
+	order, err := app.models.Orders.GetById(mux.Vars(r)["orderId"])
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	member := app.contextGetMember(r)
+
+	permissions, err := app.memberPermissions(member)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return nil, false
+	}
+
+	staff := permissions.Include("orders:manage")
+
+	if order.MemberID != member.ID && !staff {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	return order, staff
+}
+
+func (app *application) getOrderByIdHandler(w http.ResponseWriter, r *http.Request) {
+	order, _ := app.getOrder(w, r)
+	if order == nil {
+		return
+	}
+
+	app.writeOrder(w, r, http.StatusOK, "order", order, nil)
+}
+
+// updateOrderStatusHandler moves an order through its lifecycle. Members may cancel their
+// own orders, every other transition is reserved for staff holding orders:manage.
+func (app *application) updateOrderStatusHandler(w http.ResponseWriter, r *http.Request) {
+	order, staff := app.getOrder(w, r)
+	if order == nil {
+		return
+	}
+
+	var input struct {
+		Status string `json:"status"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if model.ValidateOrderStatus(v, input.Status); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !staff && (order.MemberID != app.contextGetMember(r).ID || input.Status != model.OrderStatusCancelled) {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	err = app.models.Orders.UpdateStatus(order, input.Status)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrInvalidStatusTransition):
+			v.AddError("status", fmt.Sprintf("cannot change from %s to %s", order.Status, input.Status))
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, model.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeOrder(w, r, http.StatusOK, "order", order, nil)
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/shohin-cloud/dishes-api/pkg/dishes/model"
+	"github.com/shohin-cloud/dishes-api/pkg/dishes/validator"
+)
+
+// priceItem looks up the dish or drink named in the URL and returns its type and ID. It sends
+// the error response itself and returns false when the item can't be found.
+func (app *application) priceItem(w http.ResponseWriter, r *http.Request) (string, string, bool) {
+	vars := mux.Vars(r)
+
+	var itemType, id string
+	var err error
+
+	if param, ok := vars["dishId"]; ok {
+		var dish *model.Dish
+		dish, err = app.models.Dishes.GetById(param)
+		if err == nil {
+			itemType, id = model.AuditEntityDish, dish.ID
+		}
+	} else {
+		var drink *model.Drink
+		drink, err = app.models.Drinks.GetById(vars["drinkId"])
+		if err == nil {
+			itemType, id = model.AuditEntityDrink, drink.ID
+		}
+	}
+
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return "", "", false
+	}
+
+	return itemType, id, true
+}
+
+// listPriceHistoryHandler lists the price changes of a dish or drink, newest first.
+func (app *application) listPriceHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	itemType, id, ok := app.priceItem(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		model.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	app.rejectCursor(qs, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "-id")
+
+	input.Filters.SortSafelist = []string{"id", "-id"}
+
+	if model.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	prices, metadata, err := app.models.Prices.GetHistory(itemType, id, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"prices": prices, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createScheduledPriceHandler schedules a future price for a dish or drink.
+func (app *application) createScheduledPriceHandler(w http.ResponseWriter, r *http.Request) {
+	itemType, id, ok := app.priceItem(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Price         float64    `json:"price"`
+		EffectiveFrom time.Time  `json:"effectiveFrom"`
+		EffectiveTo   *time.Time `json:"effectiveTo"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	schedule := &model.ScheduledPrice{
+		Price:         input.Price,
+		EffectiveFrom: input.EffectiveFrom,
+		EffectiveTo:   input.EffectiveTo,
+	}
+
+	v := validator.New()
+
+	if model.ValidateScheduledPrice(v, schedule, time.Now()); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Prices.InsertSchedule(itemType, id, schedule)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrScheduleOverlap):
+			v.AddError("effectiveFrom", "overlaps another scheduled price")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, model.AuditActionSchedulePrice, itemType, id, nil, schedule)
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"scheduledPrice": schedule}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// listScheduledPricesHandler lists the scheduled prices of a dish or drink.
+func (app *application) listScheduledPricesHandler(w http.ResponseWriter, r *http.Request) {
+	itemType, id, ok := app.priceItem(w, r)
+	if !ok {
+		return
+	}
+
+	schedules, err := app.models.Prices.GetSchedules(itemType, id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"scheduledPrices": schedules}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// cancelScheduledPriceHandler cancels a scheduled price that hasn't taken effect yet.
+func (app *application) cancelScheduledPriceHandler(w http.ResponseWriter, r *http.Request) {
+	itemType, id, ok := app.priceItem(w, r)
+	if !ok {
+		return
+	}
+
+	schedule, err := app.models.Prices.CancelSchedule(itemType, id, mux.Vars(r)["scheduleId"])
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, model.AuditActionCancelPrice, itemType, id, nil, schedule)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"scheduledPrice": schedule}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// applyScheduledPrices applies the scheduled prices as they become due, checking every
+// interval.
+func (app *application) applyScheduledPrices(interval time.Duration) {
+	for range time.Tick(interval) {
+		changed, err := app.models.Prices.ApplyDue(time.Now())
+		if err != nil {
+			app.logger.PrintError(err, nil)
+			continue
+		}
+
+		if changed > 0 {
+			app.logger.PrintInfo("scheduled prices applied", map[string]string{
+				"prices": strconv.Itoa(changed),
+			})
+		}
+	}
+}
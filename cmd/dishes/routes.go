@@ -1,13 +1,14 @@
 package main
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/gorilla/mux"
 )
 
 // routes is our main application's router.
-func (app *application) routes() http.Handler {
+func (app *application) routes(ctx context.Context) http.Handler {
 	r := mux.NewRouter()
 	// Convert the app.notFoundResponse helper to a http.Handler using the http.HandlerFunc()
 	// adapter, and then set it as the custom error handler for 404 Not Found responses.
@@ -23,40 +24,91 @@ func (app *application) routes() http.Handler {
 	v1 := r.PathPrefix("/api/v1").Subrouter()
 
 	// Dishes
-	// v1.HandleFunc("/dishes", app.requirePermission("dishes:write", app.createDishHandler)).Methods("POST")
-	// v1.HandleFunc("/dishes", app.requirePermission("dishes:read", app.getAllDishesHandler)).Methods("GET")
-	// v1.HandleFunc("/dishes/{dishId:[0-9]+}", app.requirePermission("dishes:read", app.getDishByIdHandler)).Methods("GET")
-	// v1.HandleFunc("/dishes/{dishId:[0-9]+}", app.requirePermission("dishes:write", app.updateDishHandler)).Methods("PUT")
-	// v1.HandleFunc("/dishes/{dishId:[0-9]+}", app.requirePermission("dishes:write", app.deleteDishHandler)).Methods("DELETE")
-
-	v1.HandleFunc("/dishes", app.createDishHandler).Methods("POST")
-	v1.HandleFunc("/dishes", app.getAllDishesHandler).Methods("GET")
-	v1.HandleFunc("/dishes/{dishId:[0-9]+}", app.getDishByIdHandler).Methods("GET")
-	v1.HandleFunc("/dishes/{dishId:[0-9]+}", app.updateDishHandler).Methods("PUT")
-	v1.HandleFunc("/dishes/{dishId:[0-9]+}", app.deleteDishHandler).Methods("DELETE")
-
-    // Drinks
-    v1.HandleFunc("/drinks", app.createDrinkHandler).Methods("POST")
-    v1.HandleFunc("/drinks", app.getAllDrinksHandler).Methods("GET")
-    v1.HandleFunc("/drinks/{drinkId:[0-9]+}", app.getDrinkByIdHandler).Methods("GET")
-    v1.HandleFunc("/drinks/{drinkId:[0-9]+}", app.updateDrinkHandler).Methods("PUT")
-    v1.HandleFunc("/drinks/{drinkId:[0-9]+}", app.deleteDrinkHandler).Methods("DELETE")
+	v1.HandleFunc("/dishes", app.requirePermission("dishes:write", app.createDishHandler)).Methods("POST")
+	v1.HandleFunc("/dishes", app.requireReadPermission("dishes:read", app.getAllDishesHandler)).Methods("GET")
+	v1.HandleFunc("/dishes/{dishId:[0-9]+}", app.requireReadPermission("dishes:read", app.getDishByIdHandler)).Methods("GET")
+	v1.HandleFunc("/dishes/{dishId:[0-9]+}", app.requirePermission("dishes:write", app.updateDishHandler)).Methods("PUT")
+	v1.HandleFunc("/dishes/{dishId:[0-9]+}", app.requirePermission("dishes:write", app.deleteDishHandler)).Methods("DELETE")
+	v1.HandleFunc("/dishes/{dishId:[0-9]+}/restore", app.requirePermission("dishes:write", app.restoreDishHandler)).Methods("POST")
+	v1.HandleFunc("/dishes/{dishId:[0-9]+}/prices", app.requireReadPermission("dishes:read", app.listPriceHistoryHandler)).Methods("GET")
+	v1.HandleFunc("/dishes/{dishId:[0-9]+}/prices/scheduled", app.requirePermission("dishes:write", app.createScheduledPriceHandler)).Methods("POST")
+	v1.HandleFunc("/dishes/{dishId:[0-9]+}/prices/scheduled", app.requirePermission("dishes:write", app.listScheduledPricesHandler)).Methods("GET")
+	v1.HandleFunc("/dishes/{dishId:[0-9]+}/prices/scheduled/{scheduleId:[0-9]+}", app.requirePermission("dishes:write", app.cancelScheduledPriceHandler)).Methods("DELETE")
+	v1.HandleFunc("/dishes/{dishId:[0-9]+}/ingredients", app.requireReadPermission("ingredients:read", app.getDishIngredientsHandler)).Methods("GET")
+
+	// Drinks
+	v1.HandleFunc("/drinks", app.requirePermission("drinks:write", app.createDrinkHandler)).Methods("POST")
+	v1.HandleFunc("/drinks", app.requireReadPermission("drinks:read", app.getAllDrinksHandler)).Methods("GET")
+	v1.HandleFunc("/drinks/{drinkId:[0-9]+}", app.requireReadPermission("drinks:read", app.getDrinkByIdHandler)).Methods("GET")
+	v1.HandleFunc("/drinks/{drinkId:[0-9]+}", app.requirePermission("drinks:write", app.updateDrinkHandler)).Methods("PUT")
+	v1.HandleFunc("/drinks/{drinkId:[0-9]+}", app.requirePermission("drinks:write", app.deleteDrinkHandler)).Methods("DELETE")
+	v1.HandleFunc("/drinks/{drinkId:[0-9]+}/restore", app.requirePermission("drinks:write", app.restoreDrinkHandler)).Methods("POST")
+	v1.HandleFunc("/drinks/{drinkId:[0-9]+}/prices", app.requireReadPermission("drinks:read", app.listPriceHistoryHandler)).Methods("GET")
+	v1.HandleFunc("/drinks/{drinkId:[0-9]+}/prices/scheduled", app.requirePermission("drinks:write", app.createScheduledPriceHandler)).Methods("POST")
+	v1.HandleFunc("/drinks/{drinkId:[0-9]+}/prices/scheduled", app.requirePermission("drinks:write", app.listScheduledPricesHandler)).Methods("GET")
+	v1.HandleFunc("/drinks/{drinkId:[0-9]+}/prices/scheduled/{scheduleId:[0-9]+}", app.requirePermission("drinks:write", app.cancelScheduledPriceHandler)).Methods("DELETE")
 
 	// Ingredients
-	// v1.HandleFunc("/ingredients", app.createIngredientHandler).Methods("POST")
-	// v1.HandleFunc("/ingredients/{ingredientId:[0-9]+}", app.getIngredientByIdHandler).Methods("GET")
-	// v1.HandleFunc("/ingredients/{ingredientId:[0-9]+}", app.updateIngredientHandler).Methods("PUT")
-	// v1.HandleFunc("/ingredients/{ingredientId:[0-9]+}", app.deleteIngredientHandler).Methods("DELETE")
-
-	v1.HandleFunc("/ingredients", app.createIngredientHandler).Methods("POST")
-	v1.HandleFunc("/ingredients/{ingredientId:[0-9]+}", app.getIngredientByIdHandler).Methods("GET")
-	v1.HandleFunc("/ingredients/{ingredientId:[0-9]+}", app.updateIngredientHandler).Methods("PUT")
-	v1.HandleFunc("/ingredients/{ingredientId:[0-9]+}", app.deleteIngredientHandler).Methods("DELETE")
+	v1.HandleFunc("/ingredients", app.requirePermission("ingredients:write", app.createIngredientHandler)).Methods("POST")
+	v1.HandleFunc("/ingredients", app.requireReadPermission("ingredients:read", app.getAllIngredientsHandler)).Methods("GET")
+	v1.HandleFunc("/ingredients/{ingredientId:[0-9]+}", app.requireReadPermission("ingredients:read", app.getIngredientByIdHandler)).Methods("GET")
+	v1.HandleFunc("/ingredients/{ingredientId:[0-9]+}", app.requirePermission("ingredients:write", app.updateIngredientHandler)).Methods("PUT")
+	v1.HandleFunc("/ingredients/{ingredientId:[0-9]+}", app.requirePermission("ingredients:write", app.deleteIngredientHandler)).Methods("DELETE")
+	v1.HandleFunc("/ingredients/{ingredientId:[0-9]+}/restore", app.requirePermission("ingredients:write", app.restoreIngredientHandler)).Methods("POST")
+
+	// Trash
+	v1.HandleFunc("/trash", app.requireActivatedMember(app.listTrashHandler)).Methods("GET")
+
+	// Search
+	v1.HandleFunc("/search", app.requireReadMember(app.searchHandler)).Methods("GET")
+
+	// Reviews
+	v1.HandleFunc("/reviews", app.requirePermission("reviews:write", app.createReviewHandler)).Methods("POST")
+	v1.HandleFunc("/reviews", app.requireReadPermission("reviews:read", app.getAllReviewsHandler)).Methods("GET")
+	v1.HandleFunc("/reviews/{reviewId:[0-9]+}", app.requireReadPermission("reviews:read", app.getReviewByIdHandler)).Methods("GET")
+	v1.HandleFunc("/reviews/{reviewId:[0-9]+}", app.requirePermission("reviews:write", app.updateReviewHandler)).Methods("PUT")
+	v1.HandleFunc("/reviews/{reviewId:[0-9]+}", app.requirePermission("reviews:write", app.deleteReviewHandler)).Methods("DELETE")
+
+	// Orders
+	v1.HandleFunc("/orders/cart", app.requirePermission("orders:read", app.getCartHandler)).Methods("GET")
+	v1.HandleFunc("/orders/cart/items", app.requirePermission("orders:write", app.addCartItemHandler)).Methods("POST")
+	v1.HandleFunc("/orders/cart/items/{itemId:[0-9]+}", app.requirePermission("orders:write", app.updateCartItemHandler)).Methods("PUT")
+	v1.HandleFunc("/orders/cart/items/{itemId:[0-9]+}", app.requirePermission("orders:write", app.deleteCartItemHandler)).Methods("DELETE")
+	v1.HandleFunc("/orders", app.requirePermission("orders:write", app.createOrderHandler)).Methods("POST")
+	v1.HandleFunc("/orders", app.requirePermission("orders:read", app.getAllOrdersHandler)).Methods("GET")
+	v1.HandleFunc("/orders/{orderId:[0-9]+}", app.requirePermission("orders:read", app.getOrderByIdHandler)).Methods("GET")
+	v1.HandleFunc("/orders/{orderId:[0-9]+}/status", app.requirePermission("orders:write", app.updateOrderStatusHandler)).Methods("PUT")
+
+	// Admin
+	v1.HandleFunc("/admin/members/{memberId:[0-9]+}/permissions", app.requirePermission("permissions:read", app.listMemberPermissionsHandler)).Methods("GET")
+	v1.HandleFunc("/admin/members/{memberId:[0-9]+}/permissions", app.requirePermission("permissions:write", app.grantMemberPermissionsHandler)).Methods("POST")
+	v1.HandleFunc("/admin/members/{memberId:[0-9]+}/permissions/{code}", app.requirePermission("permissions:write", app.revokeMemberPermissionHandler)).Methods("DELETE")
+	v1.HandleFunc("/admin/members/{memberId:[0-9]+}/roles", app.requirePermission("permissions:write", app.setMemberRolesHandler)).Methods("PUT")
+	v1.HandleFunc("/admin/members/{memberId:[0-9]+}/lockout", app.requirePermission("permissions:write", app.unlockMemberHandler)).Methods("DELETE")
+	v1.HandleFunc("/admin/audit", app.requirePermission("permissions:read", app.listAuditHandler)).Methods("GET")
+	v1.HandleFunc("/admin/trash/{type:dish|drink|ingredient}/{id:[0-9]+}", app.requireRole("admin", app.requirePermission("permissions:write", app.purgeTrashHandler))).Methods("DELETE")
+
 	// Members
 	v1.HandleFunc("/members", app.registerMemberHandler).Methods("POST")
 	v1.HandleFunc("/members/activated", app.activateMemberHandler).Methods("PUT")
+	v1.HandleFunc("/members/password", app.updateMemberPasswordHandler).Methods("PUT")
+	v1.HandleFunc("/members/me", app.requireAuthenticatedMember(app.showCurrentMemberHandler)).Methods("GET")
+	v1.HandleFunc("/members/me", app.requireAuthenticatedMember(app.rejectApiKeys(app.updateCurrentMemberHandler))).Methods("PATCH")
+	v1.HandleFunc("/members/me", app.requireAuthenticatedMember(app.rejectApiKeys(app.deleteCurrentMemberHandler))).Methods("DELETE")
+	v1.HandleFunc("/members/me/password", app.requireAuthenticatedMember(app.rejectApiKeys(app.changeCurrentMemberPasswordHandler))).Methods("PUT")
+	v1.HandleFunc("/members/me/sessions", app.requireAuthenticatedMember(app.rejectApiKeys(app.listSessionsHandler))).Methods("GET")
+	v1.HandleFunc("/members/me/sessions/{sessionId}", app.requireAuthenticatedMember(app.rejectApiKeys(app.deleteSessionHandler))).Methods("DELETE")
+	v1.HandleFunc("/members/me/api-keys", app.requireActivatedMember(app.rejectApiKeys(app.createApiKeyHandler))).Methods("POST")
+	v1.HandleFunc("/members/me/api-keys", app.requireActivatedMember(app.listApiKeysHandler)).Methods("GET")
+	v1.HandleFunc("/members/me/api-keys/{keyId:[0-9]+}", app.requireActivatedMember(app.rejectApiKeys(app.deleteApiKeyHandler))).Methods("DELETE")
 	v1.HandleFunc("/tokens/authentication", app.createAuthenticationTokenHandler).Methods("POST")
+	v1.HandleFunc("/tokens/authentication", app.requireAuthenticatedMember(app.deleteAuthenticationTokenHandler)).Methods("DELETE")
+	v1.HandleFunc("/tokens/refresh", app.refreshAuthenticationTokenHandler).Methods("POST")
+	v1.HandleFunc("/tokens/password-reset", app.createPasswordResetTokenHandler).Methods("POST")
 
-	// Wrap the router with the panic recovery middleware and rate limit middleware.
-	return app.authenticate(r)
+	// Wrap the router with the panic recovery, CORS and rate limit middleware. CORS comes before
+	// authentication so preflight requests never need credentials, and clients are limited by
+	// IP address before their credentials are looked up.
+	limited := app.rateLimit(ctx, app.memberRateLimitKey, r)
+	return app.requestID(app.recoverPanic(app.enableCORS(app.rateLimit(ctx, app.ipRateLimitKey, app.authenticate(limited)))))
 }
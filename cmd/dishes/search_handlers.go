@@ -0,0 +1,83 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/shohin-cloud/dishes-api/pkg/dishes/model"
+	"github.com/shohin-cloud/dishes-api/pkg/dishes/validator"
+)
+
+// searchPermissions maps the search result types to the permission needed to see them.
+var searchPermissions = map[string]string{
+	model.SearchTypeDish:  "dishes:read",
+	model.SearchTypeDrink: "drinks:read",
+}
+
+// searchHandler searches dishes and drinks at once. Every result carries a type field so
+// clients can tell them apart. Unless anonymous reads are enabled, members only find the
+// types they hold the read permission for.
+func (app *application) searchHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Query string
+		model.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Query = app.readString(qs, "q", "")
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	app.rejectCursor(qs, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "-relevance")
+
+	input.Filters.SortSafelist = []string{
+		"name", "price", "relevance",
+		"-name", "-price", "-relevance",
+	}
+
+	model.ValidateSearchQuery(v, input.Query)
+
+	if model.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	types := []string{model.SearchTypeDish, model.SearchTypeDrink}
+
+	if !app.config.anonymousReads {
+		permissions, err := app.memberPermissions(app.contextGetMember(r))
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		permitted := []string{}
+		for _, resultType := range types {
+			if permissions.Include(searchPermissions[resultType]) {
+				permitted = append(permitted, resultType)
+			}
+		}
+
+		if len(permitted) == 0 {
+			app.notPermittedResponse(w, r)
+			return
+		}
+
+		types = permitted
+	}
+
+	results, metadata, err := app.models.Search.Search(input.Query, types, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"results": results, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
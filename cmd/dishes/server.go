@@ -11,9 +11,13 @@ import (
 )
 
 func (app *application) serve() error {
+	// ctx is cancelled once serve returns, stopping the goroutines started by the middleware.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	srv := &http.Server{
 		Addr:         app.config.port,
-		Handler:      app.routes(),
+		Handler:      app.routes(ctx),
 		IdleTimeout:  time.Minute,
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 30 * time.Second,
@@ -37,8 +41,19 @@ func (app *application) serve() error {
 		// Shutdown() will return nil if the graceful shutdown was successful, or an
 		// error (which may happen because of a problem closing the listeners, or
 		// because the shutdown didn't complete before the 5-second context deadline is
-		// hit). We relay this return value to the shutdownError channel.
-		shutdownError <- srv.Shutdown(ctx)
+		// hit). We only relay an error to the shutdownError channel.
+		err := srv.Shutdown(ctx)
+		if err != nil {
+			shutdownError <- err
+			return
+		}
+		// Wait for background goroutines, such as emails being sent, to finish before
+		// reporting that the shutdown completed.
+		app.logger.PrintInfo("completing background tasks", map[string]string{
+			"addr": srv.Addr,
+		})
+		app.wg.Wait()
+		shutdownError <- nil
 	}()
 	app.logger.PrintInfo("starting server", map[string]string{
 		"addr": srv.Addr,
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/shohin-cloud/dishes-api/pkg/dishes/model"
+)
+
+// listSessionsHandler lists the active login sessions of the authenticated member.
+func (app *application) listSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	member := app.contextGetMember(r)
+
+	sessions, err := app.models.Tokens.GetSessionsForMember(member.ID, app.contextGetToken(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// Signed tokens aren't stored, so the current session is taken from the token itself.
+	if claims := app.contextGetClaims(r); claims != nil {
+		for _, session := range sessions {
+			session.Current = session.ID == claims.Session
+		}
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"sessions": sessions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteSessionHandler revokes one of the authenticated member's sessions, e.g. a login on a
+// lost device.
+func (app *application) deleteSessionHandler(w http.ResponseWriter, r *http.Request) {
+	member := app.contextGetMember(r)
+
+	err := app.revokeSession(member.ID, mux.Vars(r)["sessionId"])
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "session successfully revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// revokeOtherSessions ends every session of a member except the one the request was made with,
+// e.g. after a password change.
+func (app *application) revokeOtherSessions(r *http.Request, memberID int64) error {
+	sessions, err := app.models.Tokens.GetSessionsForMember(memberID, app.contextGetToken(r))
+	if err != nil {
+		return err
+	}
+
+	claims := app.contextGetClaims(r)
+
+	for _, session := range sessions {
+		current := session.Current
+		if claims != nil {
+			current = session.ID == claims.Session
+		}
+
+		if current {
+			continue
+		}
+
+		err = app.revokeSession(memberID, session.ID)
+		if err != nil && !errors.Is(err, model.ErrRecordNotFound) {
+			return err
+		}
+	}
+
+	return nil
+}
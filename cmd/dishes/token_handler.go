@@ -9,6 +9,12 @@ import (
 	"github.com/shohin-cloud/dishes-api/pkg/dishes/validator"
 )
 
+const (
+	// authenticationTokenTTL is kept short; clients renew it with their refresh token.
+	authenticationTokenTTL = time.Hour
+	refreshTokenTTL        = 30 * 24 * time.Hour
+)
+
 func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
 		Email    string `json:"email"`
@@ -29,35 +35,199 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		return
 	}
 
+	keys := app.loginKeys(input.Email, app.sessionMetadata(r).IP)
+
+	lockedUntil, err := app.loginLockedUntil(keys)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !lockedUntil.IsZero() {
+		app.tooManyLoginAttemptsResponse(w, r, lockedUntil)
+		return
+	}
+
 	member, err := app.models.Members.GetByEmail(input.Email)
+	if err != nil && !errors.Is(err, model.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	match := false
+	if member != nil {
+		match, err = member.Password.Matches(input.Password)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	} else {
+		model.CompareDummyPassword(input.Password)
+	}
+
+	// Unknown emails count as failures too, so the lockout doesn't tell which accounts exist.
+	if !match {
+		err = app.recordLoginFailure(keys)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		app.invalidCredentialsResponse(w, r)
+		return
+	}
+
+	// Only the email is cleared. Clearing the IP address would let a client reset its counter by
+	// logging into an account of its own between guesses.
+	err = app.resetLoginFailures([]loginKey{{key: emailLoginKey(input.Email)}})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	refresh, err := app.models.Tokens.NewSession(member.ID, refreshTokenTTL, app.sessionMetadata(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	token, err := app.newAuthenticationToken(member, refresh)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token, "refresh_token": refresh}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// deleteAuthenticationTokenHandler logs out the session of the token used for the request.
+func (app *application) deleteAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var err error
+
+	if claims := app.contextGetClaims(r); claims != nil {
+		err = app.revokeSignedToken(claims.ID, claims.Expiry())
+		if err == nil {
+			err = app.revokeSession(app.contextGetMember(r).ID, claims.Session)
+		}
+		if errors.Is(err, model.ErrRecordNotFound) {
+			err = nil
+		}
+	} else {
+		err = app.models.Tokens.DeleteSessionForToken(app.contextGetToken(r))
+	}
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": "you have been logged out"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// refreshAuthenticationTokenHandler exchanges a refresh token for a new authentication token.
+// The refresh token is rotated as well, so each one can only be used once.
+func (app *application) refreshAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if model.ValidateTokenPlaintext(v, input.RefreshToken); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	refresh, err := app.models.Tokens.Rotate(input.RefreshToken, refreshTokenTTL, app.sessionMetadata(r))
 	if err != nil {
 		switch {
 		case errors.Is(err, model.ErrRecordNotFound):
-			app.invalidCredentialsResponse(w, r)
+			v.AddError("refresh_token", "invalid or expired refresh token")
+			app.failedValidationResponse(w, r, v.Errors)
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	match, err := member.Password.Matches(input.Password)
+	member, err := app.models.Members.GetByID(refresh.MemberID)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	if !match {
-		app.invalidCredentialsResponse(w, r)
+	token, err := app.newAuthenticationToken(member, refresh)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	token, err := app.models.Tokens.New(member.ID, 24*time.Hour, model.ScopeAuthentication)
+	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token, "refresh_token": refresh}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// createPasswordResetTokenHandler issues a short-lived password reset token for the member
+// with the given email. The response is the same whether or not the email belongs to an
+// activated member, so it can't be used to find out who has an account.
+func (app *application) createPasswordResetTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	if model.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	member, err := app.models.Members.GetByEmail(input.Email)
+	if err != nil && !errors.Is(err, model.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = app.writeJSON(w, http.StatusCreated, envelope{"authentication_token": token}, nil)
+	if member != nil && member.Activated {
+		token, err := app.models.Tokens.New(member.ID, 45*time.Minute, model.ScopePasswordReset)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		app.background(func() {
+			data := map[string]interface{}{
+				"Name":               member.Name,
+				"PasswordResetToken": token.Plaintext,
+			}
+
+			err := app.mailer.Send(member.Email, "password_reset.tmpl", data)
+			if err != nil {
+				app.logger.PrintError(err, nil)
+			}
+		})
+	}
+
+	err = app.writeJSON(w, http.StatusAccepted, envelope{"message": "if the email address belongs to an activated account, you will receive password reset instructions"}, nil)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 	}
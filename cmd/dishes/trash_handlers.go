@@ -0,0 +1,125 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/shohin-cloud/dishes-api/pkg/dishes/model"
+	"github.com/shohin-cloud/dishes-api/pkg/dishes/validator"
+)
+
+// trashPermissions maps the trash item types to the permission needed to see and restore them.
+var trashPermissions = map[string]string{
+	model.TrashTypeDish:       "dishes:write",
+	model.TrashTypeDrink:      "drinks:write",
+	model.TrashTypeIngredient: "ingredients:write",
+}
+
+// listTrashHandler lists the deleted dishes, drinks and ingredients. Members only see the
+// types they hold the write permission for.
+func (app *application) listTrashHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Type string
+		model.Filters
+	}
+
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	input.Type = app.readString(qs, "type", "")
+	if input.Type != "" {
+		model.ValidateTrashType(v, input.Type)
+	}
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	app.rejectCursor(qs, v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "-deleted_at")
+
+	input.Filters.SortSafelist = []string{
+		"id", "name", "deleted_at",
+		"-id", "-name", "-deleted_at",
+	}
+
+	if model.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	permissions, err := app.memberPermissions(app.contextGetMember(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	types := []string{}
+	for _, itemType := range []string{model.TrashTypeDish, model.TrashTypeDrink, model.TrashTypeIngredient} {
+		if (input.Type == "" || input.Type == itemType) && permissions.Include(trashPermissions[itemType]) {
+			types = append(types, itemType)
+		}
+	}
+
+	if len(types) == 0 {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	items, metadata, err := app.models.Trash.GetAll(types, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"trash": items, "metadata": metadata}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// purgeTrashHandler permanently deletes an item from the trash.
+func (app *application) purgeTrashHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	err := app.models.Trash.Purge(vars["type"], vars["id"])
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, model.ErrRecordInUse):
+			app.recordInUseResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.audit(r, model.AuditActionPurge, vars["type"], vars["id"], nil, nil)
+
+	err = app.writeJSON(w, http.StatusOK, envelope{"message": vars["type"] + " successfully purged"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// purgeTrash permanently deletes the items that have been in the trash for longer than the
+// -trash-retention, checking every interval.
+func (app *application) purgeTrash(interval time.Duration) {
+	for range time.Tick(interval) {
+		purged, err := app.models.Trash.PurgeExpired(time.Now().Add(-app.config.trash.retention))
+		if err != nil {
+			app.logger.PrintError(err, nil)
+			continue
+		}
+
+		if purged > 0 {
+			app.logger.PrintInfo("trash purged", map[string]string{
+				"items": strconv.FormatInt(purged, 10),
+			})
+		}
+	}
+}
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS reviews
+(
+    id          bigserial PRIMARY KEY,
+    createdAt   timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updatedAt   timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    member_id   bigint                      NOT NULL REFERENCES members ON DELETE CASCADE,
+    dish_id     bigint REFERENCES dishes (id) ON DELETE CASCADE,
+    drink_id    bigint REFERENCES drinks (id) ON DELETE CASCADE,
+    rating      integer                     NOT NULL,
+    comment     text                        NOT NULL DEFAULT '',
+    CONSTRAINT reviews_rating_check CHECK (rating BETWEEN 1 AND 5),
+    CONSTRAINT reviews_target_check CHECK ((dish_id IS NULL) <> (drink_id IS NULL)),
+    CONSTRAINT reviews_member_dish_key UNIQUE (member_id, dish_id),
+    CONSTRAINT reviews_member_drink_key UNIQUE (member_id, drink_id)
+);
+
+CREATE INDEX IF NOT EXISTS reviews_dish_id_idx ON reviews (dish_id);
+CREATE INDEX IF NOT EXISTS reviews_drink_id_idx ON reviews (drink_id);
@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS orders
+(
+    id          bigserial PRIMARY KEY,
+    createdAt   timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updatedAt   timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    member_id   bigint                      NOT NULL REFERENCES members ON DELETE CASCADE,
+    status      text                        NOT NULL DEFAULT 'cart',
+    total       numeric(10, 2)              NOT NULL DEFAULT 0,
+    version     integer                     NOT NULL DEFAULT 1,
+    CONSTRAINT orders_status_check CHECK (status IN ('cart', 'pending', 'preparing', 'ready', 'served', 'cancelled'))
+);
+
+-- Every member has at most one open cart.
+CREATE UNIQUE INDEX IF NOT EXISTS orders_member_cart_idx ON orders (member_id) WHERE status = 'cart';
+CREATE INDEX IF NOT EXISTS orders_member_id_idx ON orders (member_id);
+
+CREATE TABLE IF NOT EXISTS order_items
+(
+    id          bigserial PRIMARY KEY,
+    createdAt   timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    updatedAt   timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    order_id    bigint                      NOT NULL REFERENCES orders ON DELETE CASCADE,
+    dish_id     bigint REFERENCES dishes (id),
+    drink_id    bigint REFERENCES drinks (id),
+    quantity    integer                     NOT NULL,
+    unit_price  numeric(10, 2),
+    CONSTRAINT order_items_quantity_check CHECK (quantity > 0),
+    CONSTRAINT order_items_target_check CHECK ((dish_id IS NULL) <> (drink_id IS NULL))
+);
+
+CREATE INDEX IF NOT EXISTS order_items_order_id_idx ON order_items (order_id);
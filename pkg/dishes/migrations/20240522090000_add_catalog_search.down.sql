@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS drinks_name_trgm_idx;
+DROP INDEX IF EXISTS dishes_name_trgm_idx;
+DROP INDEX IF EXISTS drinks_search_vector_idx;
+DROP INDEX IF EXISTS dishes_search_vector_idx;
+
+ALTER TABLE drinks DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE dishes DROP COLUMN IF EXISTS search_vector;
@@ -0,0 +1,20 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+ALTER TABLE dishes ADD COLUMN IF NOT EXISTS search_vector tsvector
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', name), 'A') ||
+        setweight(to_tsvector('english', description), 'B')
+    ) STORED;
+
+ALTER TABLE drinks ADD COLUMN IF NOT EXISTS search_vector tsvector
+    GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', name), 'A') ||
+        setweight(to_tsvector('english', description), 'B')
+    ) STORED;
+
+CREATE INDEX IF NOT EXISTS dishes_search_vector_idx ON dishes USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS drinks_search_vector_idx ON drinks USING GIN (search_vector);
+
+-- Trigram indexes back the fuzzy name matching used for typos.
+CREATE INDEX IF NOT EXISTS dishes_name_trgm_idx ON dishes USING GIN (name gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS drinks_name_trgm_idx ON drinks USING GIN (name gin_trgm_ops);
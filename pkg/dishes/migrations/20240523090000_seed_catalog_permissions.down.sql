@@ -0,0 +1,10 @@
+DELETE FROM permissions
+WHERE code IN (
+    'dishes:read', 'dishes:write',
+    'drinks:read', 'drinks:write',
+    'ingredients:read', 'ingredients:write',
+    'reviews:read', 'reviews:write',
+    'orders:read', 'orders:write', 'orders:manage'
+);
+
+DROP INDEX IF EXISTS permissions_code_idx;
@@ -0,0 +1,24 @@
+CREATE UNIQUE INDEX IF NOT EXISTS permissions_code_idx ON permissions (code);
+
+INSERT INTO permissions (code)
+VALUES
+    ('dishes:read'),
+    ('dishes:write'),
+    ('drinks:read'),
+    ('drinks:write'),
+    ('ingredients:read'),
+    ('ingredients:write'),
+    ('reviews:read'),
+    ('reviews:write'),
+    ('orders:read'),
+    ('orders:write'),
+    ('orders:manage')
+ON CONFLICT (code) DO NOTHING;
+
+-- Give existing members the permissions new members receive on registration.
+INSERT INTO members_permissions (member_id, permission_id)
+SELECT members.id, permissions.id
+FROM members
+CROSS JOIN permissions
+WHERE permissions.code IN ('dishes:read', 'drinks:read', 'ingredients:read', 'reviews:read', 'reviews:write', 'orders:read', 'orders:write')
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,68 @@
+INSERT INTO permissions (code)
+VALUES
+    ('permissions:read'),
+    ('permissions:write')
+ON CONFLICT (code) DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS roles (
+    id bigserial PRIMARY KEY,
+    code text UNIQUE NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS roles_permissions (
+    role_id bigint NOT NULL REFERENCES roles ON DELETE CASCADE,
+    permission_id bigint NOT NULL REFERENCES permissions ON DELETE CASCADE,
+    PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE TABLE IF NOT EXISTS members_roles (
+    member_id bigint NOT NULL REFERENCES members ON DELETE CASCADE,
+    role_id bigint NOT NULL REFERENCES roles ON DELETE CASCADE,
+    PRIMARY KEY (member_id, role_id)
+);
+
+INSERT INTO roles (code)
+VALUES
+    ('admin'),
+    ('staff'),
+    ('customer')
+ON CONFLICT (code) DO NOTHING;
+
+-- Admins can do everything.
+INSERT INTO roles_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles
+CROSS JOIN permissions
+WHERE roles.code = 'admin'
+ON CONFLICT DO NOTHING;
+
+-- Staff manage the catalog and the kitchen.
+INSERT INTO roles_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles
+CROSS JOIN permissions
+WHERE roles.code = 'staff'
+AND permissions.code IN (
+    'dishes:read', 'dishes:write',
+    'drinks:read', 'drinks:write',
+    'ingredients:read', 'ingredients:write',
+    'reviews:read', 'reviews:write',
+    'orders:read', 'orders:write', 'orders:manage'
+)
+ON CONFLICT DO NOTHING;
+
+-- Customers browse the catalog, write reviews and place orders.
+INSERT INTO roles_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles
+CROSS JOIN permissions
+WHERE roles.code = 'customer'
+AND permissions.code IN ('dishes:read', 'drinks:read', 'ingredients:read', 'reviews:read', 'reviews:write', 'orders:read', 'orders:write')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO members_roles (member_id, role_id)
+SELECT members.id, roles.id
+FROM members
+CROSS JOIN roles
+WHERE roles.code = 'customer'
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS tokens_member_scope_idx;
+DROP INDEX IF EXISTS tokens_session_idx;
+
+DELETE FROM tokens WHERE scope = 'refresh';
+
+ALTER TABLE tokens
+    DROP COLUMN IF EXISTS ip,
+    DROP COLUMN IF EXISTS user_agent,
+    DROP COLUMN IF EXISTS last_used_at,
+    DROP COLUMN IF EXISTS created_at,
+    DROP COLUMN IF EXISTS session;
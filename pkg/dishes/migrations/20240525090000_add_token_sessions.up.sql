@@ -0,0 +1,12 @@
+ALTER TABLE tokens
+    ADD COLUMN IF NOT EXISTS session text NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    ADD COLUMN IF NOT EXISTS last_used_at timestamp(0) with time zone,
+    ADD COLUMN IF NOT EXISTS user_agent text NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS ip text NOT NULL DEFAULT '';
+
+-- Tokens issued before sessions existed become sessions of their own.
+UPDATE tokens SET session = encode(hash, 'hex') WHERE session = '';
+
+CREATE INDEX IF NOT EXISTS tokens_session_idx ON tokens (session);
+CREATE INDEX IF NOT EXISTS tokens_member_scope_idx ON tokens (member_id, scope);
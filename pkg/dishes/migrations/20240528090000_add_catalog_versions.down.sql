@@ -0,0 +1,3 @@
+ALTER TABLE ingredients DROP COLUMN IF EXISTS version;
+ALTER TABLE drinks DROP COLUMN IF EXISTS version;
+ALTER TABLE dishes DROP COLUMN IF EXISTS version;
@@ -0,0 +1,3 @@
+ALTER TABLE dishes ADD COLUMN IF NOT EXISTS version integer NOT NULL DEFAULT 1;
+ALTER TABLE drinks ADD COLUMN IF NOT EXISTS version integer NOT NULL DEFAULT 1;
+ALTER TABLE ingredients ADD COLUMN IF NOT EXISTS version integer NOT NULL DEFAULT 1;
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS ingredients_dish_name_key;
+DROP INDEX IF EXISTS drinks_name_key;
+DROP INDEX IF EXISTS dishes_name_key;
@@ -0,0 +1,20 @@
+-- Names that only differ in case would make the indexes fail, so all but the oldest of them get
+-- their ID appended first.
+UPDATE dishes
+SET name = dishes.name || ' (' || dishes.id || ')', version = dishes.version + 1
+FROM dishes AS first
+WHERE LOWER(first.name) = LOWER(dishes.name) AND first.id < dishes.id;
+
+UPDATE drinks
+SET name = drinks.name || ' (' || drinks.id || ')', version = drinks.version + 1
+FROM drinks AS first
+WHERE LOWER(first.name) = LOWER(drinks.name) AND first.id < drinks.id;
+
+UPDATE ingredients
+SET name = ingredients.name || ' (' || ingredients.id || ')', version = ingredients.version + 1
+FROM ingredients AS first
+WHERE first.dish_id = ingredients.dish_id AND LOWER(first.name) = LOWER(ingredients.name) AND first.id < ingredients.id;
+
+CREATE UNIQUE INDEX IF NOT EXISTS dishes_name_key ON dishes (LOWER(name));
+CREATE UNIQUE INDEX IF NOT EXISTS drinks_name_key ON drinks (LOWER(name));
+CREATE UNIQUE INDEX IF NOT EXISTS ingredients_dish_name_key ON ingredients (dish_id, LOWER(name));
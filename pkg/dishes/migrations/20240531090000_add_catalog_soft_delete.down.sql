@@ -0,0 +1,17 @@
+ALTER TABLE ingredients DROP CONSTRAINT IF EXISTS ingredients_dish_id_fkey;
+ALTER TABLE ingredients ADD CONSTRAINT ingredients_dish_id_fkey FOREIGN KEY (dish_id) REFERENCES dishes (id);
+
+DROP INDEX IF EXISTS ingredients_dish_name_key;
+DROP INDEX IF EXISTS drinks_name_key;
+DROP INDEX IF EXISTS dishes_name_key;
+CREATE UNIQUE INDEX IF NOT EXISTS dishes_name_key ON dishes (LOWER(name));
+CREATE UNIQUE INDEX IF NOT EXISTS drinks_name_key ON drinks (LOWER(name));
+CREATE UNIQUE INDEX IF NOT EXISTS ingredients_dish_name_key ON ingredients (dish_id, LOWER(name));
+
+DROP INDEX IF EXISTS ingredients_deleted_at_idx;
+DROP INDEX IF EXISTS drinks_deleted_at_idx;
+DROP INDEX IF EXISTS dishes_deleted_at_idx;
+
+ALTER TABLE ingredients DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE drinks DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE dishes DROP COLUMN IF EXISTS deleted_at;
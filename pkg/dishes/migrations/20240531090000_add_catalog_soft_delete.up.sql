@@ -0,0 +1,19 @@
+ALTER TABLE dishes ADD COLUMN IF NOT EXISTS deleted_at timestamp(0) with time zone;
+ALTER TABLE drinks ADD COLUMN IF NOT EXISTS deleted_at timestamp(0) with time zone;
+ALTER TABLE ingredients ADD COLUMN IF NOT EXISTS deleted_at timestamp(0) with time zone;
+
+CREATE INDEX IF NOT EXISTS dishes_deleted_at_idx ON dishes (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS drinks_deleted_at_idx ON drinks (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS ingredients_deleted_at_idx ON ingredients (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- Items in the trash don't keep their name taken.
+DROP INDEX IF EXISTS dishes_name_key;
+DROP INDEX IF EXISTS drinks_name_key;
+DROP INDEX IF EXISTS ingredients_dish_name_key;
+CREATE UNIQUE INDEX IF NOT EXISTS dishes_name_key ON dishes (LOWER(name)) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS drinks_name_key ON drinks (LOWER(name)) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS ingredients_dish_name_key ON ingredients (dish_id, LOWER(name)) WHERE deleted_at IS NULL;
+
+-- Purging a dish takes its ingredients with it.
+ALTER TABLE ingredients DROP CONSTRAINT IF EXISTS ingredients_dish_id_fkey;
+ALTER TABLE ingredients ADD CONSTRAINT ingredients_dish_id_fkey FOREIGN KEY (dish_id) REFERENCES dishes (id) ON DELETE CASCADE;
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS audit_log
+(
+    id          bigserial PRIMARY KEY,
+    created_at  timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    -- No foreign key, so that the entries outlive deleted members. NULL for anonymous requests.
+    actor_id    bigint,
+    action      text                        NOT NULL,
+    entity_type text                        NOT NULL,
+    entity_id   text                        NOT NULL,
+    changes     jsonb                       NOT NULL DEFAULT '{}',
+    request_id  text                        NOT NULL DEFAULT '',
+    ip          text                        NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_actor_id_idx ON audit_log (actor_id);
+CREATE INDEX IF NOT EXISTS audit_log_entity_idx ON audit_log (entity_type, entity_id);
+CREATE INDEX IF NOT EXISTS audit_log_created_at_idx ON audit_log (created_at);
@@ -0,0 +1,42 @@
+CREATE TABLE IF NOT EXISTS price_history
+(
+    id             bigserial PRIMARY KEY,
+    createdAt      timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    dish_id        bigint REFERENCES dishes (id) ON DELETE CASCADE,
+    drink_id       bigint REFERENCES drinks (id) ON DELETE CASCADE,
+    price          numeric(10, 2)              NOT NULL,
+    -- NULL for the price an item was created with.
+    previous_price numeric(10, 2),
+    CONSTRAINT price_history_target_check CHECK ((dish_id IS NULL) <> (drink_id IS NULL))
+);
+
+CREATE INDEX IF NOT EXISTS price_history_dish_id_idx ON price_history (dish_id);
+CREATE INDEX IF NOT EXISTS price_history_drink_id_idx ON price_history (drink_id);
+
+-- The current prices are the start of the history.
+INSERT INTO price_history (createdAt, dish_id, price)
+SELECT createdAt, id, price FROM dishes;
+INSERT INTO price_history (createdAt, drink_id, price)
+SELECT createdAt, id, price FROM drinks;
+
+CREATE TABLE IF NOT EXISTS scheduled_prices
+(
+    id             bigserial PRIMARY KEY,
+    createdAt      timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    dish_id        bigint REFERENCES dishes (id) ON DELETE CASCADE,
+    drink_id       bigint REFERENCES drinks (id) ON DELETE CASCADE,
+    price          numeric(10, 2)              NOT NULL,
+    effective_from timestamp(0) with time zone NOT NULL,
+    -- NULL for a permanent change, otherwise the previous price comes back at effective_to.
+    effective_to   timestamp(0) with time zone,
+    status         text                        NOT NULL DEFAULT 'pending',
+    -- The price the schedule replaced, set once it is applied.
+    previous_price numeric(10, 2),
+    CONSTRAINT scheduled_prices_target_check CHECK ((dish_id IS NULL) <> (drink_id IS NULL)),
+    CONSTRAINT scheduled_prices_window_check CHECK (effective_to IS NULL OR effective_to > effective_from),
+    CONSTRAINT scheduled_prices_status_check CHECK (status IN ('pending', 'active', 'completed', 'skipped', 'cancelled'))
+);
+
+CREATE INDEX IF NOT EXISTS scheduled_prices_dish_id_idx ON scheduled_prices (dish_id);
+CREATE INDEX IF NOT EXISTS scheduled_prices_drink_id_idx ON scheduled_prices (drink_id);
+CREATE INDEX IF NOT EXISTS scheduled_prices_due_idx ON scheduled_prices (status) WHERE status IN ('pending', 'active');
@@ -0,0 +1,194 @@
+package model
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/shohin-cloud/dishes-api/pkg/dishes/validator"
+)
+
+// ApiKey is a long-lived credential for machine clients such as POS terminals. It acts on
+// behalf of the member who created it, limited to a subset of that member's permissions.
+type ApiKey struct {
+	ID          int64       `json:"id"`
+	CreatedAt   time.Time   `json:"created_at"`
+	MemberID    int64       `json:"-"`
+	Name        string      `json:"name"`
+	Plaintext   string      `json:"key,omitempty"`
+	Prefix      string      `json:"prefix"`
+	Hash        []byte      `json:"-"`
+	Permissions Permissions `json:"permissions"`
+	Expiry      *time.Time  `json:"expiry"`
+	LastUsedAt  *time.Time  `json:"last_used_at"`
+}
+
+// NewApiKey generates a key for a member. The plaintext is only available until the key is
+// stored; afterwards it is identified by its prefix.
+func NewApiKey(memberID int64, name string, permissions Permissions, expiry *time.Time) (*ApiKey, error) {
+	plaintext, hash, err := generateSecret(32)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ApiKey{
+		MemberID:    memberID,
+		Name:        name,
+		Plaintext:   plaintext,
+		Prefix:      plaintext[:8],
+		Hash:        hash,
+		Permissions: permissions,
+		Expiry:      expiry,
+	}, nil
+}
+
+// ValidateApiKey checks a new key. granted holds the permissions of the member creating it;
+// a key can't be given anything the member doesn't have.
+func ValidateApiKey(v *validator.Validator, key *ApiKey, granted Permissions) {
+	v.Check(key.Name != "", "name", "must be provided")
+	v.Check(len(key.Name) <= 100, "name", "must not be more than 100 bytes long")
+
+	v.Check(len(key.Permissions) > 0, "permissions", "must contain at least one entry")
+	for _, code := range key.Permissions {
+		v.Check(granted.Include(code), "permissions", "must only contain permissions you have been granted")
+	}
+	v.Check(validator.Unique(key.Permissions), "permissions", "must not contain duplicate values")
+
+	if key.Expiry != nil {
+		v.Check(key.Expiry.After(time.Now()), "expiry", "must be in the future")
+	}
+}
+
+func ValidateApiKeyPlaintext(v *validator.Validator, plaintext string) {
+	v.Check(plaintext != "", "key", "must be provided")
+	v.Check(len(plaintext) == 52, "key", "must be 52 bytes long")
+}
+
+// ApiKeyModel manages interactions with the api_keys table in the database.
+type ApiKeyModel struct {
+	DB *sql.DB
+}
+
+func (m ApiKeyModel) Insert(key *ApiKey) error {
+	query := `
+	INSERT INTO api_keys (member_id, name, prefix, hash, permissions, expiry)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING id, created_at`
+	args := []interface{}{key.MemberID, key.Name, key.Prefix, key.Hash, pq.Array(key.Permissions), key.Expiry}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&key.ID, &key.CreatedAt)
+}
+
+// GetAllForMember lists the keys of a member, including expired ones.
+func (m ApiKeyModel) GetAllForMember(memberID int64) ([]*ApiKey, error) {
+	query := `
+	SELECT id, created_at, member_id, name, prefix, permissions, expiry, last_used_at
+	FROM api_keys
+	WHERE member_id = $1
+	ORDER BY id`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, memberID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*ApiKey{}
+	for rows.Next() {
+		var key ApiKey
+		err := rows.Scan(
+			&key.ID,
+			&key.CreatedAt,
+			&key.MemberID,
+			&key.Name,
+			&key.Prefix,
+			pq.Array(&key.Permissions),
+			&key.Expiry,
+			&key.LastUsedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, &key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// GetForKey looks up an unexpired key by its plaintext.
+func (m ApiKeyModel) GetForKey(plaintext string) (*ApiKey, error) {
+	hash := sha256.Sum256([]byte(plaintext))
+	query := `
+	SELECT id, created_at, member_id, name, prefix, permissions, expiry, last_used_at
+	FROM api_keys
+	WHERE hash = $1
+	AND (expiry IS NULL OR expiry > $2)`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var key ApiKey
+	err := m.DB.QueryRowContext(ctx, query, hash[:], time.Now()).Scan(
+		&key.ID,
+		&key.CreatedAt,
+		&key.MemberID,
+		&key.Name,
+		&key.Prefix,
+		pq.Array(&key.Permissions),
+		&key.Expiry,
+		&key.LastUsedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &key, nil
+}
+
+// Touch records that a key was just used, at most once a minute.
+func (m ApiKeyModel) Touch(id int64) error {
+	query := `
+	UPDATE api_keys
+	SET last_used_at = NOW()
+	WHERE id = $1
+	AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, id)
+	return err
+}
+
+// Delete revokes a key of a member.
+func (m ApiKeyModel) Delete(id, memberID int64) error {
+	query := `
+	DELETE FROM api_keys
+	WHERE id = $1 AND member_id = $2`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, memberID)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
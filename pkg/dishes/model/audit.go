@@ -0,0 +1,226 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/shohin-cloud/dishes-api/pkg/dishes/validator"
+)
+
+// Entity types recorded in the audit log.
+const (
+	AuditEntityDish       = "dish"
+	AuditEntityDrink      = "drink"
+	AuditEntityIngredient = "ingredient"
+	AuditEntityMember     = "member"
+)
+
+// Actions recorded in the audit log.
+const (
+	AuditActionCreate           = "create"
+	AuditActionUpdate           = "update"
+	AuditActionDelete           = "delete"
+	AuditActionRestore          = "restore"
+	AuditActionPurge            = "purge"
+	AuditActionActivate         = "activate"
+	AuditActionResetPassword    = "reset_password"
+	AuditActionChangePassword   = "change_password"
+	AuditActionGrantPermissions = "grant_permissions"
+	AuditActionRevokePermission = "revoke_permission"
+	AuditActionSetRoles         = "set_roles"
+	AuditActionUnlock           = "unlock"
+	AuditActionSchedulePrice    = "schedule_price"
+	AuditActionCancelPrice      = "cancel_price"
+)
+
+// auditIgnoredFields are left out of the recorded changes: they change on every write or are
+// computed from other records.
+var auditIgnoredFields = []string{"createdAt", "updatedAt", "created_at", "average_rating", "review_count", "ingredients"}
+
+// AuditChange is the value of a field before and after a change. From is missing for created
+// records and To for deleted ones.
+type AuditChange struct {
+	From interface{} `json:"from,omitempty"`
+	To   interface{} `json:"to,omitempty"`
+}
+
+// AuditEntry records who changed which record, and how.
+type AuditEntry struct {
+	ID         int64                  `json:"id"`
+	CreatedAt  time.Time              `json:"created_at"`
+	ActorID    *int64                 `json:"actor_id"`
+	Action     string                 `json:"action"`
+	EntityType string                 `json:"entity_type"`
+	EntityID   string                 `json:"entity_id"`
+	Changes    map[string]AuditChange `json:"changes"`
+	RequestID  string                 `json:"request_id"`
+	IP         string                 `json:"ip"`
+}
+
+// AuditFilter narrows down the audit log. Zero values don't filter anything.
+type AuditFilter struct {
+	ActorID    int64
+	Action     string
+	EntityType string
+	EntityID   string
+	Since      *time.Time
+	Until      *time.Time
+}
+
+// AuditModel manages interactions with the audit_log table in the database.
+type AuditModel struct {
+	DB *sql.DB
+}
+
+func ValidateAuditFilter(v *validator.Validator, f AuditFilter) {
+	v.Check(f.ActorID >= 0, "actor_id", "must be a positive integer")
+	v.Check(f.EntityType == "" || validator.In(f.EntityType, AuditEntityDish, AuditEntityDrink, AuditEntityIngredient, AuditEntityMember),
+		"entity_type", "must be dish, drink, ingredient or member")
+	v.Check(f.EntityID == "" || f.EntityType != "", "entity_type", "must be provided with entity_id")
+	v.Check(f.Since == nil || f.Until == nil || f.Since.Before(*f.Until), "until", "must be after since")
+}
+
+// AuditDiff returns the fields whose JSON encoding differs between before and after. Pass nil
+// as before for created records and as after for deleted ones.
+func AuditDiff(before, after interface{}) (map[string]AuditChange, error) {
+	from, err := auditFields(before)
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := auditFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string]AuditChange)
+
+	for key, value := range from {
+		if !reflect.DeepEqual(value, to[key]) {
+			changes[key] = AuditChange{From: value, To: to[key]}
+		}
+	}
+
+	for key, value := range to {
+		if _, ok := from[key]; !ok {
+			changes[key] = AuditChange{To: value}
+		}
+	}
+
+	return changes, nil
+}
+
+// auditFields decodes the JSON encoding of a record into a map of its fields.
+func auditFields(record interface{}) (map[string]interface{}, error) {
+	fields := make(map[string]interface{})
+
+	if record == nil {
+		return fields, nil
+	}
+
+	js, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(js, &fields)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range auditIgnoredFields {
+		delete(fields, key)
+	}
+
+	return fields, nil
+}
+
+// Insert adds an entry to the audit log.
+func (m AuditModel) Insert(entry *AuditEntry) error {
+	changes, err := json.Marshal(entry.Changes)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO audit_log (actor_id, action, entity_type, entity_id, changes, request_id, ip)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at`
+
+	args := []interface{}{entry.ActorID, entry.Action, entry.EntityType, entry.EntityID, changes, entry.RequestID, entry.IP}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&entry.ID, &entry.CreatedAt)
+}
+
+// GetAll lists the audit log entries matching the filter.
+func (m AuditModel) GetAll(f AuditFilter, filters Filters) ([]*AuditEntry, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, created_at, actor_id, action, entity_type, entity_id, changes, request_id, ip
+		FROM audit_log
+		WHERE (actor_id = $1 OR $1 = 0)
+		AND (action = $2 OR $2 = '')
+		AND (entity_type = $3 OR $3 = '')
+		AND (entity_id = $4 OR $4 = '')
+		AND (created_at >= $5 OR $5 IS NULL)
+		AND (created_at < $6 OR $6 IS NULL)
+		ORDER BY %s %s, id DESC
+		LIMIT $7 OFFSET $8`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{f.ActorID, f.Action, f.EntityType, f.EntityID, f.Since, f.Until, filters.limit(), filters.offset()}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	entries := []*AuditEntry{}
+
+	for rows.Next() {
+		var entry AuditEntry
+		var changes []byte
+
+		err := rows.Scan(
+			&totalRecords,
+			&entry.ID,
+			&entry.CreatedAt,
+			&entry.ActorID,
+			&entry.Action,
+			&entry.EntityType,
+			&entry.EntityID,
+			&changes,
+			&entry.RequestID,
+			&entry.IP,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		err = json.Unmarshal(changes, &entry.Changes)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		entries = append(entries, &entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return entries, metadata, nil
+}
@@ -0,0 +1,78 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAuditDiff(t *testing.T) {
+	dish := &Dish{ID: "1", Name: "Plov", Description: "Rice with lamb", Price: 40, Version: 1}
+
+	renamed := *dish
+	renamed.Name = "Oshi palov"
+	renamed.Price = 45
+	renamed.Version = 2
+
+	touched := *dish
+	touched.UpdatedAt = "2024-06-01T12:00:00Z"
+	touched.Version = 2
+
+	tests := []struct {
+		name   string
+		before interface{}
+		after  interface{}
+		want   map[string]AuditChange
+	}{
+		{
+			name:   "created",
+			before: nil,
+			after:  map[string]interface{}{"name": "Plov", "price": 40},
+			want: map[string]AuditChange{
+				"name":  {To: "Plov"},
+				"price": {To: float64(40)},
+			},
+		},
+		{
+			name:   "deleted",
+			before: map[string]interface{}{"name": "Plov"},
+			after:  nil,
+			want: map[string]AuditChange{
+				"name": {From: "Plov"},
+			},
+		},
+		{
+			name:   "updated",
+			before: dish,
+			after:  &renamed,
+			want: map[string]AuditChange{
+				"name":  {From: "Plov", To: "Oshi palov"},
+				"price": {From: float64(40), To: float64(45)},
+			},
+		},
+		{
+			name:   "only ignored and hidden fields changed",
+			before: dish,
+			after:  &touched,
+			want:   map[string]AuditChange{},
+		},
+		{
+			name:   "unchanged",
+			before: dish,
+			after:  dish,
+			want:   map[string]AuditChange{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := AuditDiff(tt.before, tt.after)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
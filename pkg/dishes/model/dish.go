@@ -3,11 +3,18 @@ package model
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"time"
+
+	"github.com/lib/pq"
+	"github.com/shohin-cloud/dishes-api/pkg/dishes/validator"
 )
 
+// ErrDuplicateDishName is returned when another dish already has the same name.
+var ErrDuplicateDishName = errors.New("duplicate dish name")
+
 type Dish struct {
 	ID          string  `json:"id"`
 	CreatedAt   string  `json:"createdAt"`
@@ -15,6 +22,15 @@ type Dish struct {
 	Name        string  `json:"name"`
 	Description string  `json:"description"`
 	Price       float64 `json:"price"`
+	Version     int     `json:"-"`
+
+	AverageRating *float64 `json:"average_rating,omitempty"`
+	ReviewCount   *int     `json:"review_count,omitempty"`
+
+	// relevance is the search rank computed by GetAll, kept for keyset pagination.
+	relevance float64
+
+	Ingredients []*Ingredient `json:"ingredients,omitempty"`
 }
 
 type DishModel struct {
@@ -23,38 +39,75 @@ type DishModel struct {
 	ErrorLog *log.Logger
 }
 
-func (d DishModel) Insert(dish *Dish) error {
-	fmt.Println(dish.Name, dish.Description, dish.Price)
+func ValidateDish(v *validator.Validator, dish *Dish) {
+	v.Check(dish.Name != "", "name", "must be provided")
+	v.Check(len(dish.Name) <= 500, "name", "must not be more than 500 bytes long")
+	v.Check(len(dish.Description) <= 2000, "description", "must not be more than 2000 bytes long")
+	v.Check(dish.Price > 0, "price", "must be greater than zero")
+	v.Check(dish.Price < 100000000, "price", "must be less than 100000000")
+}
 
+func (d DishModel) Insert(dish *Dish) error {
+	// The first price of the dish starts its price history.
 	query := `
-		INSERT INTO dishes (name, description, price)
-		VALUES ($1, $2, $3)
-		RETURNING id, createdat, updatedat
+		WITH dish AS (
+			INSERT INTO dishes (name, description, price)
+			VALUES ($1, $2, $3)
+			RETURNING id, createdat, updatedat, version, price
+		), history AS (
+			INSERT INTO price_history (dish_id, price)
+			SELECT id, price FROM dish
+		)
+		SELECT id, createdat, updatedat, version FROM dish
 	`
 	args := []interface{}{dish.Name, dish.Description, dish.Price}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	return d.DB.QueryRowContext(ctx, query, args...).Scan(&dish.ID, &dish.CreatedAt, &dish.UpdatedAt)
+	err := d.DB.QueryRowContext(ctx, query, args...).Scan(&dish.ID, &dish.CreatedAt, &dish.UpdatedAt, &dish.Version)
+	if err != nil {
+		switch violatedConstraint(err) {
+		case "dishes_name_key":
+			return ErrDuplicateDishName
+		default:
+			return err
+		}
+	}
+
+	return nil
 }
 
-func (d DishModel) GetAll(name string, price string, filters Filters) ([]*Dish, Metadata, error) {
-	if price == "" {
-		price = "0"
-	}
+func (d DishModel) GetAll(search string, filters Filters) ([]*Dish, Metadata, error) {
 	query := fmt.Sprintf(`
-		SELECT count(*) OVER(), id, createdAt, updatedAt, name, description, price
+		SELECT %s, id, createdAt, updatedAt, name, description, price,
+			ts_rank(search_vector, plainto_tsquery('english', $1)) + similarity(name, $1) AS relevance
 		FROM dishes
-		WHERE (LOWER(name) = LOWER($1) OR $1 = '')
-		AND (price >= $2 OR $2 = 0)
-		ORDER BY %s %s, id ASC
-		LIMIT $3 OFFSET $4
-	`, filters.sortColumn(), filters.sortDirection())
+		WHERE deleted_at IS NULL
+		AND ($1 = ''
+			OR search_vector @@ plainto_tsquery('english', $1)
+			OR name %% $1
+			OR $1 <%% name)
+		AND (price >= $2 OR $2 IS NULL)
+		AND (price <= $3 OR $3 IS NULL)
+		AND (createdAt > $4 OR $4 IS NULL)
+		AND (updatedAt < $5 OR $5 IS NULL)
+		AND (id = ANY($6) OR cardinality($6) = 0)
+		AND (description ILIKE $7 OR $7 = '')`, filters.countColumn())
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []interface{}{name, price, filters.limit(), filters.offset()}
+	args := []interface{}{
+		search,
+		filters.PriceMin,
+		filters.PriceMax,
+		filters.CreatedAfter,
+		filters.UpdatedBefore,
+		pq.Array(filters.IDs),
+		filters.containsPattern(),
+	}
+
+	query, args = filters.paginate(query, args)
 
 	rows, err := d.DB.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -77,6 +130,7 @@ func (d DishModel) GetAll(name string, price string, filters Filters) ([]*Dish,
 			&dish.Name,
 			&dish.Description,
 			&dish.Price,
+			&dish.relevance,
 		)
 
 		if err != nil {
@@ -90,56 +144,200 @@ func (d DishModel) GetAll(name string, price string, filters Filters) ([]*Dish,
 		return nil, Metadata{}, err
 	}
 
-	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	dishes, metadata := paginateResults(dishes, totalRecords, filters, (*Dish).cursorKey)
 
 	return dishes, metadata, nil // Return users and nil error
 }
 
 func (d DishModel) GetById(id string) (*Dish, error) {
+	if !validID(id) {
+		return nil, ErrRecordNotFound
+	}
+
 	query := `
-		SELECT id, createdat, updatedat, name, description, price
+		SELECT id, createdat, updatedat, name, description, price, version
 		FROM dishes
-		WHERE id = $1
+		WHERE id = $1 AND deleted_at IS NULL
 	`
 	var dish Dish
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	row := d.DB.QueryRowContext(ctx, query, id)
-	err := row.Scan(&dish.ID, &dish.CreatedAt, &dish.UpdatedAt, &dish.Name, &dish.Description, &dish.Price)
+	err := row.Scan(&dish.ID, &dish.CreatedAt, &dish.UpdatedAt, &dish.Name, &dish.Description, &dish.Price, &dish.Version)
 
 	if err != nil {
-		return nil, err
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
 	}
 
 	return &dish, nil
 }
 
 func (d DishModel) Update(dish *Dish) error {
+	// A changed price is added to the price history in the same statement. All parts of the
+	// statement see the dish as it was before the update, so old holds the previous price.
 	query := `
-		UPDATE dishes
-		SET name = $1, description = $2, price = $3
-		WHERE id = $4
-		RETURNING updatedat
+		WITH old AS (
+			SELECT id, price FROM dishes WHERE id = $4 AND version = $5
+		), dish AS (
+			UPDATE dishes
+			SET name = $1, description = $2, price = $3, updatedat = NOW(), version = version + 1
+			WHERE id = $4 AND version = $5
+			RETURNING id, price, updatedat, version
+		), history AS (
+			INSERT INTO price_history (dish_id, price, previous_price)
+			SELECT dish.id, dish.price, old.price
+			FROM dish
+			INNER JOIN old ON old.id = dish.id
+			WHERE dish.price <> old.price
+		)
+		SELECT updatedat, version FROM dish
 	`
 
-	args := []interface{}{dish.Name, dish.Description, dish.Price, dish.ID}
+	args := []interface{}{dish.Name, dish.Description, dish.Price, dish.ID, dish.Version}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	return d.DB.QueryRowContext(ctx, query, args...).Scan(&dish.UpdatedAt)
+	err := d.DB.QueryRowContext(ctx, query, args...).Scan(&dish.UpdatedAt, &dish.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		case violatedConstraint(err) == "dishes_name_key":
+			return ErrDuplicateDishName
+		default:
+			return err
+		}
+	}
+
+	return nil
 }
 
+// Delete moves a dish and its ingredients to the trash. They are hidden from the other methods
+// until they are restored or purged.
 func (d DishModel) Delete(id string) error {
+	if !validID(id) {
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := d.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	query := `
-		DELETE FROM dishes
-		WHERE id = $1
+		UPDATE dishes
+		SET deleted_at = NOW(), version = version + 1
+		WHERE id = $1 AND deleted_at IS NULL
 	`
 
+	result, err := tx.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	// NOW() is the start of the transaction, so the ingredients get the same deleted_at as the
+	// dish, which is how Restore finds them again.
+	query = `
+		UPDATE ingredients
+		SET deleted_at = NOW(), version = version + 1
+		WHERE dish_id = $1 AND deleted_at IS NULL
+	`
+
+	_, err = tx.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Restore takes a dish out of the trash, together with the ingredients that were trashed
+// along with it.
+func (d DishModel) Restore(id string) error {
+	if !validID(id) {
+		return ErrRecordNotFound
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	_, err := d.DB.ExecContext(ctx, query, id)
+	tx, err := d.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
-	return err
+	query := `
+		UPDATE dishes
+		SET deleted_at = NULL, version = dishes.version + 1
+		FROM (SELECT id, deleted_at FROM dishes WHERE id = $1 AND deleted_at IS NOT NULL FOR UPDATE) AS trashed
+		WHERE dishes.id = trashed.id
+		RETURNING trashed.deleted_at
+	`
+
+	var deletedAt time.Time
+
+	err = tx.QueryRowContext(ctx, query, id).Scan(&deletedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		case violatedConstraint(err) == "dishes_name_key":
+			return ErrDuplicateDishName
+		default:
+			return err
+		}
+	}
+
+	query = `
+		UPDATE ingredients
+		SET deleted_at = NULL, version = version + 1
+		WHERE dish_id = $1 AND deleted_at = $2
+	`
+
+	_, err = tx.ExecContext(ctx, query, id, deletedAt)
+	if err != nil {
+		switch {
+		case violatedConstraint(err) == "ingredients_dish_name_key":
+			return ErrDuplicateIngredientName
+		default:
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// cursorKey returns the value of the given sort column and the id of the dish, used to build
+// keyset pagination cursors.
+func (d *Dish) cursorKey(column string) (interface{}, string) {
+	switch column {
+	case "name":
+		return d.Name, d.ID
+	case "price":
+		return d.Price, d.ID
+	case "relevance":
+		return d.relevance, d.ID
+	default:
+		return d.ID, d.ID
+	}
 }
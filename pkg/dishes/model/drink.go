@@ -3,11 +3,18 @@ package model
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"time"
+
+	"github.com/lib/pq"
+	"github.com/shohin-cloud/dishes-api/pkg/dishes/validator"
 )
 
+// ErrDuplicateDrinkName is returned when another drink already has the same name.
+var ErrDuplicateDrinkName = errors.New("duplicate drink name")
+
 // Drink represents a drink entity.
 type Drink struct {
 	ID          string  `json:"id"`
@@ -16,6 +23,13 @@ type Drink struct {
 	Name        string  `json:"name"`
 	Description string  `json:"description"`
 	Price       float64 `json:"price"`
+	Version     int     `json:"-"`
+
+	AverageRating *float64 `json:"average_rating,omitempty"`
+	ReviewCount   *int     `json:"review_count,omitempty"`
+
+	// relevance is the search rank computed by GetAll, kept for keyset pagination.
+	relevance float64
 }
 
 // DrinkModel manages interactions with the drink table in the database.
@@ -25,40 +39,78 @@ type DrinkModel struct {
 	ErrorLog *log.Logger
 }
 
+// ValidateDrink checks the fields of a drink before it is stored.
+func ValidateDrink(v *validator.Validator, drink *Drink) {
+	v.Check(drink.Name != "", "name", "must be provided")
+	v.Check(len(drink.Name) <= 500, "name", "must not be more than 500 bytes long")
+	v.Check(len(drink.Description) <= 2000, "description", "must not be more than 2000 bytes long")
+	v.Check(drink.Price > 0, "price", "must be greater than zero")
+	v.Check(drink.Price < 100000000, "price", "must be less than 100000000")
+}
+
 // Insert inserts a new drink into the database.
 func (d DrinkModel) Insert(drink *Drink) error {
-	fmt.Println(drink.Name, drink.Description, drink.Price)
-
+	// The first price of the drink starts its price history.
 	query := `
-		INSERT INTO drinks (name, description, price)
-		VALUES ($1, $2, $3)
-		RETURNING id, createdat, updatedat
+		WITH drink AS (
+			INSERT INTO drinks (name, description, price)
+			VALUES ($1, $2, $3)
+			RETURNING id, createdat, updatedat, version, price
+		), history AS (
+			INSERT INTO price_history (drink_id, price)
+			SELECT id, price FROM drink
+		)
+		SELECT id, createdat, updatedat, version FROM drink
 	`
 	args := []interface{}{drink.Name, drink.Description, drink.Price}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	return d.DB.QueryRowContext(ctx, query, args...).Scan(&drink.ID, &drink.CreatedAt, &drink.UpdatedAt)
+	err := d.DB.QueryRowContext(ctx, query, args...).Scan(&drink.ID, &drink.CreatedAt, &drink.UpdatedAt, &drink.Version)
+	if err != nil {
+		switch violatedConstraint(err) {
+		case "drinks_name_key":
+			return ErrDuplicateDrinkName
+		default:
+			return err
+		}
+	}
+
+	return nil
 }
 
 // GetAll retrieves all drinks from the database.
-func (d DrinkModel) GetAll(name string, price string, filters Filters) ([]*Drink, Metadata, error) {
-	if price == "" {
-		price = "0"
-	}
+func (d DrinkModel) GetAll(search string, filters Filters) ([]*Drink, Metadata, error) {
 	query := fmt.Sprintf(`
-		SELECT count(*) OVER(), id, createdAt, updatedAt, name, description, price
+		SELECT %s, id, createdAt, updatedAt, name, description, price,
+			ts_rank(search_vector, plainto_tsquery('english', $1)) + similarity(name, $1) AS relevance
 		FROM drinks
-		WHERE (LOWER(name) = LOWER($1) OR $1 = '')
-		AND (price >= $2 OR $2 = 0)
-		ORDER BY %s %s, id ASC
-		LIMIT $3 OFFSET $4
-	`, filters.sortColumn(), filters.sortDirection())
+		WHERE deleted_at IS NULL
+		AND ($1 = ''
+			OR search_vector @@ plainto_tsquery('english', $1)
+			OR name %% $1
+			OR $1 <%% name)
+		AND (price >= $2 OR $2 IS NULL)
+		AND (price <= $3 OR $3 IS NULL)
+		AND (createdAt > $4 OR $4 IS NULL)
+		AND (updatedAt < $5 OR $5 IS NULL)
+		AND (id = ANY($6) OR cardinality($6) = 0)
+		AND (description ILIKE $7 OR $7 = '')`, filters.countColumn())
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []interface{}{name, price, filters.limit(), filters.offset()}
+	args := []interface{}{
+		search,
+		filters.PriceMin,
+		filters.PriceMax,
+		filters.CreatedAfter,
+		filters.UpdatedBefore,
+		pq.Array(filters.IDs),
+		filters.containsPattern(),
+	}
+
+	query, args = filters.paginate(query, args)
 
 	rows, err := d.DB.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -81,6 +133,7 @@ func (d DrinkModel) GetAll(name string, price string, filters Filters) ([]*Drink
 			&drink.Name,
 			&drink.Description,
 			&drink.Price,
+			&drink.relevance,
 		)
 
 		if err != nil {
@@ -94,27 +147,36 @@ func (d DrinkModel) GetAll(name string, price string, filters Filters) ([]*Drink
 		return nil, Metadata{}, err
 	}
 
-	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	drinks, metadata := paginateResults(drinks, totalRecords, filters, (*Drink).cursorKey)
 
 	return drinks, metadata, nil
 }
 
 // GetById retrieves a drink by ID from the database.
 func (d DrinkModel) GetById(id string) (*Drink, error) {
+	if !validID(id) {
+		return nil, ErrRecordNotFound
+	}
+
 	query := `
-		SELECT id, createdat, updatedat, name, description, price
+		SELECT id, createdat, updatedat, name, description, price, version
 		FROM drinks
-		WHERE id = $1
+		WHERE id = $1 AND deleted_at IS NULL
 	`
 	var drink Drink
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	row := d.DB.QueryRowContext(ctx, query, id)
-	err := row.Scan(&drink.ID, &drink.CreatedAt, &drink.UpdatedAt, &drink.Name, &drink.Description, &drink.Price)
+	err := row.Scan(&drink.ID, &drink.CreatedAt, &drink.UpdatedAt, &drink.Name, &drink.Description, &drink.Price, &drink.Version)
 
 	if err != nil {
-		return nil, err
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
 	}
 
 	return &drink, nil
@@ -122,31 +184,126 @@ func (d DrinkModel) GetById(id string) (*Drink, error) {
 
 // Update updates a drink in the database.
 func (d DrinkModel) Update(drink *Drink) error {
+	// A changed price is added to the price history in the same statement. All parts of the
+	// statement see the drink as it was before the update, so old holds the previous price.
 	query := `
-		UPDATE drinks
-		SET name = $1, description = $2, price = $3
-		WHERE id = $4
-		RETURNING updatedat
+		WITH old AS (
+			SELECT id, price FROM drinks WHERE id = $4 AND version = $5
+		), drink AS (
+			UPDATE drinks
+			SET name = $1, description = $2, price = $3, updatedat = NOW(), version = version + 1
+			WHERE id = $4 AND version = $5
+			RETURNING id, price, updatedat, version
+		), history AS (
+			INSERT INTO price_history (drink_id, price, previous_price)
+			SELECT drink.id, drink.price, old.price
+			FROM drink
+			INNER JOIN old ON old.id = drink.id
+			WHERE drink.price <> old.price
+		)
+		SELECT updatedat, version FROM drink
 	`
 
-	args := []interface{}{drink.Name, drink.Description, drink.Price, drink.ID}
+	args := []interface{}{drink.Name, drink.Description, drink.Price, drink.ID, drink.Version}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	return d.DB.QueryRowContext(ctx, query, args...).Scan(&drink.UpdatedAt)
+	err := d.DB.QueryRowContext(ctx, query, args...).Scan(&drink.UpdatedAt, &drink.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		case violatedConstraint(err) == "drinks_name_key":
+			return ErrDuplicateDrinkName
+		default:
+			return err
+		}
+	}
+
+	return nil
 }
 
-// Delete deletes a drink from the database.
+// Delete moves a drink to the trash. It is hidden from the other methods until it is restored
+// or purged.
 func (d DrinkModel) Delete(id string) error {
+	if !validID(id) {
+		return ErrRecordNotFound
+	}
+
 	query := `
-		DELETE FROM drinks
-		WHERE id = $1
+		UPDATE drinks
+		SET deleted_at = NOW(), version = version + 1
+		WHERE id = $1 AND deleted_at IS NULL
 	`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	_, err := d.DB.ExecContext(ctx, query, id)
+	result, err := d.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
 
-	return err
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Restore takes a drink out of the trash.
+func (d DrinkModel) Restore(id string) error {
+	if !validID(id) {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		UPDATE drinks
+		SET deleted_at = NULL, version = version + 1
+		WHERE id = $1 AND deleted_at IS NOT NULL
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := d.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		switch {
+		case violatedConstraint(err) == "drinks_name_key":
+			return ErrDuplicateDrinkName
+		default:
+			return err
+		}
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// cursorKey returns the value of the given sort column and the id of the drink, used to build
+// keyset pagination cursors.
+func (d *Drink) cursorKey(column string) (interface{}, string) {
+	switch column {
+	case "name":
+		return d.Name, d.ID
+	case "price":
+		return d.Price, d.ID
+	case "relevance":
+		return d.relevance, d.ID
+	default:
+		return d.ID, d.ID
+	}
 }
@@ -1,8 +1,13 @@
 package model
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
 	"math"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/shohin-cloud/dishes-api/pkg/dishes/validator"
 )
@@ -12,6 +17,59 @@ type Filters struct {
 	PageSize     int
 	Sort         string
 	SortSafelist []string
+
+	// Optional narrowing filters shared by the catalog list endpoints. Nil and empty values
+	// don't filter anything.
+	PriceMin      *float64
+	PriceMax      *float64
+	CreatedAfter  *time.Time
+	UpdatedBefore *time.Time
+	IDs           []int64
+	Contains      string
+
+	// UseCursor switches to keyset pagination: Cursor holds the opaque next_cursor token of
+	// the previous page (empty for the first page) and Page is ignored. The window count is
+	// only computed in this mode when WithTotal is set.
+	UseCursor bool
+	Cursor    string
+	WithTotal bool
+}
+
+// cursor is the decoded form of a keyset pagination token. It remembers the sort it was
+// created for, and the sort column value and id of the last row on the page.
+type cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    string `json:"id"`
+}
+
+func encodeCursor(sort string, value interface{}, id string) string {
+	c := cursor{Sort: sort, ID: id}
+
+	switch v := value.(type) {
+	case float64:
+		c.Value = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		c.Value = fmt.Sprint(v)
+	}
+
+	js, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+func decodeCursor(token string) (*cursor, error) {
+	js, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, err
+	}
+
+	var c cursor
+	err = json.Unmarshal(js, &c)
+	if err != nil {
+		return nil, err
+	}
+
+	return &c, nil
 }
 
 func (f Filters) limit() int {
@@ -22,6 +80,16 @@ func (f Filters) offset() int {
 	return (f.Page - 1) * f.PageSize
 }
 
+// containsPattern returns an ILIKE pattern matching the Contains filter anywhere in a column,
+// or an empty string when the filter isn't set.
+func (f Filters) containsPattern() string {
+	if f.Contains == "" {
+		return ""
+	}
+	replacer := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+	return "%" + replacer.Replace(f.Contains) + "%"
+}
+
 func (f Filters) sortColumn() string {
 	for _, safeValue := range f.SortSafelist {
 		if f.Sort == safeValue {
@@ -39,6 +107,47 @@ func (f Filters) sortDirection() string {
 	return "ASC"
 }
 
+// countColumn returns the select expression for the total number of matching records. The
+// window count is skipped in keyset mode unless the client asked for the total.
+func (f Filters) countColumn() string {
+	if f.UseCursor && !f.WithTotal {
+		return "0"
+	}
+	return "count(*) OVER()"
+}
+
+// paginate appends the ordering and pagination to a base query, adding the needed arguments.
+// The base query has to select the id and the sort column. In keyset mode the base query is
+// wrapped so that the sort column can also be a computed alias such as relevance, and one
+// extra row is fetched to find out whether there is a next page.
+func (f Filters) paginate(query string, args []interface{}) (string, []interface{}) {
+	column, direction := f.sortColumn(), f.sortDirection()
+
+	if !f.UseCursor {
+		query = fmt.Sprintf(`%s
+		ORDER BY %s %s, id ASC
+		LIMIT $%d OFFSET $%d`, query, column, direction, len(args)+1, len(args)+2)
+		return query, append(args, f.limit(), f.offset())
+	}
+
+	where := ""
+	if c, err := decodeCursor(f.Cursor); f.Cursor != "" && err == nil {
+		operator := ">"
+		if direction == "DESC" {
+			operator = "<"
+		}
+		where = fmt.Sprintf("WHERE page.%[1]s %[2]s $%[3]d OR (page.%[1]s = $%[3]d AND page.id > $%[4]d)",
+			column, operator, len(args)+1, len(args)+2)
+		args = append(args, c.Value, c.ID)
+	}
+
+	query = fmt.Sprintf(`SELECT * FROM (%s) AS page
+		%s
+		ORDER BY page.%s %s, page.id ASC
+		LIMIT $%d`, query, where, column, direction, len(args)+1)
+	return query, append(args, f.limit()+1)
+}
+
 func ValidateFilters(v *validator.Validator, f Filters) {
 	// Check that the page and page_size parameters contain sensible values.
 	v.Check(f.Page > 0, "page", "must be greater than zero")
@@ -47,14 +156,39 @@ func ValidateFilters(v *validator.Validator, f Filters) {
 	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
 	// Check that the sort parameter matches a value in the safelist.
 	v.Check(validator.In(f.Sort, f.SortSafelist...), "sort", "invalid sort value")
+
+	if f.PriceMin != nil {
+		v.Check(*f.PriceMin >= 0, "price_min", "must not be negative")
+	}
+	if f.PriceMax != nil {
+		v.Check(*f.PriceMax >= 0, "price_max", "must not be negative")
+	}
+	if f.PriceMin != nil && f.PriceMax != nil {
+		v.Check(*f.PriceMax >= *f.PriceMin, "price_max", "must be greater than or equal to price_min")
+	}
+	if f.CreatedAfter != nil && f.UpdatedBefore != nil {
+		v.Check(f.UpdatedBefore.After(*f.CreatedAfter), "updated_before", "must be later than created_after")
+	}
+	v.Check(len(f.IDs) <= 100, "ids", "must not contain more than 100 values")
+	for _, id := range f.IDs {
+		v.Check(id > 0, "ids", "must only contain positive integers")
+	}
+	v.Check(len(f.Contains) <= 100, "contains", "must not be more than 100 bytes long")
+
+	if f.Cursor != "" {
+		c, err := decodeCursor(f.Cursor)
+		v.Check(err == nil, "cursor", "invalid cursor")
+		v.Check(err != nil || c.Sort == f.Sort, "cursor", "does not match the sort parameter")
+	}
 }
 
 type Metadata struct {
-	CurrentPage  int `json:"current_page,omitempty"`
-	PageSize     int `json:"page_size,omitempty"`
-	FirstPage    int `json:"first_page,omitempty"`
-	LastPage     int `json:"last_page,omitempty"`
-	TotalRecords int `json:"total_records,omitempty"`
+	CurrentPage  int    `json:"current_page,omitempty"`
+	PageSize     int    `json:"page_size,omitempty"`
+	FirstPage    int    `json:"first_page,omitempty"`
+	LastPage     int    `json:"last_page,omitempty"`
+	TotalRecords int    `json:"total_records,omitempty"`
+	NextCursor   string `json:"next_cursor,omitempty"`
 }
 
 func calculateMetadata(totalRecords, page, pageSize int) Metadata {
@@ -70,3 +204,22 @@ func calculateMetadata(totalRecords, page, pageSize int) Metadata {
 		TotalRecords: totalRecords,
 	}
 }
+
+// paginateResults builds the metadata for a page of records fetched with paginate. In keyset
+// mode it drops the extra look-ahead row and derives next_cursor from the last row kept, using
+// key to get the sort column value and id of a record.
+func paginateResults[T any](records []T, totalRecords int, f Filters, key func(T, string) (interface{}, string)) ([]T, Metadata) {
+	if !f.UseCursor {
+		return records, calculateMetadata(totalRecords, f.Page, f.PageSize)
+	}
+
+	metadata := Metadata{PageSize: f.PageSize, TotalRecords: totalRecords}
+
+	if len(records) > f.PageSize {
+		records = records[:f.PageSize]
+		value, id := key(records[len(records)-1], f.sortColumn())
+		metadata.NextCursor = encodeCursor(f.Sort, value, id)
+	}
+
+	return records, metadata
+}
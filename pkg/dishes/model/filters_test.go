@@ -0,0 +1,124 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	"github.com/shohin-cloud/dishes-api/pkg/dishes/validator"
+)
+
+func TestCursor(t *testing.T) {
+	tests := []struct {
+		name  string
+		sort  string
+		value interface{}
+		id    string
+		want  string
+	}{
+		{name: "string", sort: "name", value: "Plov", id: "3", want: "Plov"},
+		{name: "float", sort: "-price", value: 12.5, id: "7", want: "12.5"},
+		{name: "whole float", sort: "price", value: float64(100000000), id: "8", want: "100000000"},
+		{name: "integer", sort: "id", value: 42, id: "42", want: "42"},
+		{name: "empty", sort: "name", value: "", id: "1", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := decodeCursor(encodeCursor(tt.sort, tt.value, tt.id))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if c.Sort != tt.sort || c.Value != tt.want || c.ID != tt.id {
+				t.Errorf("got %+v; want sort %q, value %q and id %q", c, tt.sort, tt.want, tt.id)
+			}
+		})
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	for _, token := range []string{"not base64!", "bm90IGpzb24"} {
+		if _, err := decodeCursor(token); err == nil {
+			t.Errorf("decodeCursor(%q): got no error", token)
+		}
+	}
+}
+
+func TestValidateFilters(t *testing.T) {
+	price := func(p float64) *float64 { return &p }
+	now := time.Now()
+	earlier := now.Add(-time.Hour)
+
+	valid := Filters{Page: 1, PageSize: 20, Sort: "id", SortSafelist: []string{"id", "-id", "name"}}
+
+	tests := []struct {
+		name   string
+		modify func(f *Filters)
+		fields []string
+	}{
+		{name: "valid", modify: func(f *Filters) {}},
+		{name: "zero page", modify: func(f *Filters) { f.Page = 0 }, fields: []string{"page"}},
+		{name: "page too large", modify: func(f *Filters) { f.Page = 10_000_001 }, fields: []string{"page"}},
+		{name: "zero page size", modify: func(f *Filters) { f.PageSize = 0 }, fields: []string{"page_size"}},
+		{name: "page size too large", modify: func(f *Filters) { f.PageSize = 101 }, fields: []string{"page_size"}},
+		{name: "unsafe sort", modify: func(f *Filters) { f.Sort = "password" }, fields: []string{"sort"}},
+		{name: "negative price", modify: func(f *Filters) { f.PriceMin = price(-1) }, fields: []string{"price_min"}},
+		{
+			name:   "price range reversed",
+			modify: func(f *Filters) { f.PriceMin, f.PriceMax = price(10), price(5) },
+			fields: []string{"price_max"},
+		},
+		{
+			name:   "dates reversed",
+			modify: func(f *Filters) { f.CreatedAfter, f.UpdatedBefore = &now, &earlier },
+			fields: []string{"updated_before"},
+		},
+		{name: "non-positive id", modify: func(f *Filters) { f.IDs = []int64{1, 0} }, fields: []string{"ids"}},
+		{name: "too many ids", modify: func(f *Filters) { f.IDs = make([]int64, 101) }, fields: []string{"ids"}},
+		{
+			name:   "contains too long",
+			modify: func(f *Filters) { f.Contains = string(make([]byte, 101)) },
+			fields: []string{"contains"},
+		},
+		{name: "invalid cursor", modify: func(f *Filters) { f.Cursor = "not base64!" }, fields: []string{"cursor"}},
+		{
+			name:   "cursor of another sort",
+			modify: func(f *Filters) { f.Cursor = encodeCursor("name", "Plov", "1") },
+			fields: []string{"cursor"},
+		},
+		{
+			name:   "cursor of the same sort",
+			modify: func(f *Filters) { f.Cursor = encodeCursor("id", 1, "1") },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := valid
+			tt.modify(&f)
+
+			v := validator.New()
+			ValidateFilters(v, f)
+
+			if len(v.Errors) != len(tt.fields) {
+				t.Fatalf("got errors %v; want errors for %v", v.Errors, tt.fields)
+			}
+
+			for _, field := range tt.fields {
+				if _, ok := v.Errors[field]; !ok {
+					t.Errorf("got errors %v; want an error for %q", v.Errors, field)
+				}
+			}
+		})
+	}
+}
+
+func TestSortColumnUnsafe(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("got no panic for an unsafe sort parameter")
+		}
+	}()
+
+	Filters{Sort: "password", SortSafelist: []string{"id", "-id"}}.sortColumn()
+}
@@ -3,9 +3,26 @@ package model
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"regexp"
 	"time"
+
+	"github.com/lib/pq"
+	"github.com/shohin-cloud/dishes-api/pkg/dishes/validator"
+)
+
+var (
+	// ErrDuplicateIngredientName is returned when the dish already has an ingredient with the
+	// same name.
+	ErrDuplicateIngredientName = errors.New("duplicate ingredient name")
+
+	// ErrInvalidIngredientDish is returned when the dish of an ingredient doesn't exist.
+	ErrInvalidIngredientDish = errors.New("invalid ingredient dish")
+
+	// idRX matches the textual form of a bigserial ID.
+	idRX = regexp.MustCompile(`^[1-9][0-9]{0,17}$`)
 )
 
 type Ingredient struct {
@@ -15,6 +32,7 @@ type Ingredient struct {
 	Name      string `json:"name"`
 	Quantity  int    `json:"quantity"`
 	DishID    string `json:"dishId"`
+	Version   int    `json:"-"`
 }
 
 type IngredientModel struct {
@@ -23,36 +41,182 @@ type IngredientModel struct {
 	ErrorLog *log.Logger
 }
 
+func ValidateIngredient(v *validator.Validator, ingredient *Ingredient) {
+	v.Check(ingredient.Name != "", "name", "must be provided")
+	v.Check(len(ingredient.Name) <= 500, "name", "must not be more than 500 bytes long")
+	v.Check(ingredient.Quantity > 0, "quantity", "must be greater than zero")
+	v.Check(ingredient.Quantity <= 10000, "quantity", "must be a maximum of 10000")
+	v.Check(ingredient.DishID != "", "dishId", "must be provided")
+	v.Check(ingredient.DishID == "" || validator.Matches(ingredient.DishID, idRX), "dishId", "must be a valid dish id")
+}
+
 func (i IngredientModel) Insert(ingredient *Ingredient) error {
 	fmt.Println(ingredient.Name, ingredient.Quantity)
 
 	query := `
 		INSERT INTO ingredients (name, quantity, dish_id)
-		VALUES ($1, $2, $3)
-		RETURNING id, createdat, updatedat
+		SELECT $1, $2, $3
+		WHERE EXISTS (SELECT 1 FROM dishes WHERE id = $3 AND deleted_at IS NULL)
+		RETURNING id, createdat, updatedat, version
 	`
 	args := []interface{}{ingredient.Name, ingredient.Quantity, ingredient.DishID}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	return i.DB.QueryRowContext(ctx, query, args...).Scan(&ingredient.ID, &ingredient.CreatedAt, &ingredient.UpdatedAt)
+	// Nothing is inserted when the dish is missing or in the trash.
+	err := i.DB.QueryRowContext(ctx, query, args...).Scan(&ingredient.ID, &ingredient.CreatedAt, &ingredient.UpdatedAt, &ingredient.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrInvalidIngredientDish
+		case violatedConstraint(err) == "ingredients_dish_name_key":
+			return ErrDuplicateIngredientName
+		case violatedConstraint(err) == "ingredients_dish_id_fkey":
+			return ErrInvalidIngredientDish
+		default:
+			return err
+		}
+	}
+
+	return nil
 }
 
-func (i IngredientModel) GetById(id string) (*Ingredient, error) {
+func (i IngredientModel) GetAll(name string, dishID int64, filters Filters) ([]*Ingredient, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT %s, id, createdAt, updatedAt, name, quantity, dish_id
+		FROM ingredients
+		WHERE deleted_at IS NULL
+		AND (LOWER(name) = LOWER($1) OR $1 = '')
+		AND (dish_id = $2 OR $2 = 0)
+		AND (createdAt > $3 OR $3 IS NULL)
+		AND (updatedAt < $4 OR $4 IS NULL)
+		AND (id = ANY($5) OR cardinality($5) = 0)
+		AND (name ILIKE $6 OR $6 = '')`, filters.countColumn())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{
+		name,
+		dishID,
+		filters.CreatedAfter,
+		filters.UpdatedBefore,
+		pq.Array(filters.IDs),
+		filters.containsPattern(),
+	}
+
+	query, args = filters.paginate(query, args)
+
+	rows, err := i.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	ingredients := []*Ingredient{}
+
+	for rows.Next() {
+		var ingredient Ingredient
+
+		err := rows.Scan(
+			&totalRecords,
+			&ingredient.ID,
+			&ingredient.CreatedAt,
+			&ingredient.UpdatedAt,
+			&ingredient.Name,
+			&ingredient.Quantity,
+			&ingredient.DishID,
+		)
+
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		ingredients = append(ingredients, &ingredient)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	ingredients, metadata := paginateResults(ingredients, totalRecords, filters, (*Ingredient).cursorKey)
+
+	return ingredients, metadata, nil
+}
+
+// GetAllForDish retrieves every ingredient of a dish, used when embedding them in the dish.
+func (i IngredientModel) GetAllForDish(dishID string) ([]*Ingredient, error) {
 	query := `
 		SELECT id, createdat, updatedat, name, quantity, dish_id
 		FROM ingredients
-		WHERE id = $1
+		WHERE dish_id = $1 AND deleted_at IS NULL
+		ORDER BY id ASC
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := i.DB.QueryContext(ctx, query, dishID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	ingredients := []*Ingredient{}
+
+	for rows.Next() {
+		var ingredient Ingredient
+
+		err := rows.Scan(
+			&ingredient.ID,
+			&ingredient.CreatedAt,
+			&ingredient.UpdatedAt,
+			&ingredient.Name,
+			&ingredient.Quantity,
+			&ingredient.DishID,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		ingredients = append(ingredients, &ingredient)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ingredients, nil
+}
+
+func (i IngredientModel) GetById(id string) (*Ingredient, error) {
+	if !validID(id) {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, createdat, updatedat, name, quantity, dish_id, version
+		FROM ingredients
+		WHERE id = $1 AND deleted_at IS NULL
 	`
 	var ingredient Ingredient
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	row := i.DB.QueryRowContext(ctx, query, id)
-	err := row.Scan(&ingredient.ID, &ingredient.CreatedAt, &ingredient.UpdatedAt, &ingredient.Name, &ingredient.Quantity, &ingredient.DishID)
+	err := row.Scan(&ingredient.ID, &ingredient.CreatedAt, &ingredient.UpdatedAt, &ingredient.Name, &ingredient.Quantity, &ingredient.DishID, &ingredient.Version)
 
 	if err != nil {
-		return nil, err
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
 	}
 
 	return &ingredient, nil
@@ -61,28 +225,133 @@ func (i IngredientModel) GetById(id string) (*Ingredient, error) {
 func (i IngredientModel) Update(ingredient *Ingredient) error {
 	query := `
 		UPDATE ingredients
-		SET name = $1, quantity = $2, dish_id = $3
-		WHERE id = $4
-		RETURNING updatedat
+		SET name = $1, quantity = $2, dish_id = $3, updatedat = NOW(), version = version + 1
+		WHERE id = $4 AND version = $5
+		RETURNING updatedat, version
 	`
 
-	args := []interface{}{ingredient.Name, ingredient.Quantity, ingredient.DishID, ingredient.ID}
+	args := []interface{}{ingredient.Name, ingredient.Quantity, ingredient.DishID, ingredient.ID, ingredient.Version}
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	return i.DB.QueryRowContext(ctx, query, args...).Scan(&ingredient.UpdatedAt)
+	err := i.DB.QueryRowContext(ctx, query, args...).Scan(&ingredient.UpdatedAt, &ingredient.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		case violatedConstraint(err) == "ingredients_dish_name_key":
+			return ErrDuplicateIngredientName
+		case violatedConstraint(err) == "ingredients_dish_id_fkey":
+			return ErrInvalidIngredientDish
+		default:
+			return err
+		}
+	}
+
+	return nil
 }
 
+// Delete moves an ingredient to the trash. It is hidden from the other methods until it is
+// restored or purged.
 func (i IngredientModel) Delete(id string) error {
+	if !validID(id) {
+		return ErrRecordNotFound
+	}
+
 	query := `
-		DELETE FROM ingredients
-		WHERE id = $1
+		UPDATE ingredients
+		SET deleted_at = NOW(), version = version + 1
+		WHERE id = $1 AND deleted_at IS NULL
 	`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	_, err := i.DB.ExecContext(ctx, query, id)
+	result, err := i.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Restore takes an ingredient out of the trash. Ingredients of a dish that is itself in the
+// trash can only come back together with the dish.
+func (i IngredientModel) Restore(id string) error {
+	if !validID(id) {
+		return ErrRecordNotFound
+	}
 
-	return err
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := i.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+		SELECT dishes.deleted_at IS NOT NULL
+		FROM ingredients
+		INNER JOIN dishes ON dishes.id = ingredients.dish_id
+		WHERE ingredients.id = $1 AND ingredients.deleted_at IS NOT NULL
+		FOR UPDATE
+	`
+
+	var dishTrashed bool
+
+	err = tx.QueryRowContext(ctx, query, id).Scan(&dishTrashed)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	if dishTrashed {
+		return ErrInvalidIngredientDish
+	}
+
+	query = `
+		UPDATE ingredients
+		SET deleted_at = NULL, version = version + 1
+		WHERE id = $1
+	`
+
+	_, err = tx.ExecContext(ctx, query, id)
+	if err != nil {
+		switch {
+		case violatedConstraint(err) == "ingredients_dish_name_key":
+			return ErrDuplicateIngredientName
+		default:
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// cursorKey returns the value of the given sort column and the id of the ingredient, used to
+// build keyset pagination cursors.
+func (i *Ingredient) cursorKey(column string) (interface{}, string) {
+	switch column {
+	case "name":
+		return i.Name, i.ID
+	case "quantity":
+		return i.Quantity, i.ID
+	default:
+		return i.ID, i.ID
+	}
 }
@@ -0,0 +1,120 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// LoginAttempt counts the failed logins for a key, which is either an email address or a
+// client IP address.
+type LoginAttempt struct {
+	Key           string
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   *time.Time
+}
+
+// LoginAttemptModel manages interactions with the login_attempts table in the database.
+type LoginAttemptModel struct {
+	DB *sql.DB
+}
+
+// Get returns the failed logins for a key. A key without failures yields an empty attempt.
+func (m LoginAttemptModel) Get(key string) (*LoginAttempt, error) {
+	query := `
+	SELECT key, failures, last_failure_at, locked_until
+	FROM login_attempts
+	WHERE key = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var attempt LoginAttempt
+	err := m.DB.QueryRowContext(ctx, query, key).Scan(
+		&attempt.Key,
+		&attempt.Failures,
+		&attempt.LastFailureAt,
+		&attempt.LockedUntil,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return &LoginAttempt{Key: key}, nil
+		default:
+			return nil, err
+		}
+	}
+
+	return &attempt, nil
+}
+
+// RecordFailure counts a failed login for a key. Failures older than a day are forgotten.
+func (m LoginAttemptModel) RecordFailure(key string) (*LoginAttempt, error) {
+	query := `
+	INSERT INTO login_attempts (key, failures, last_failure_at)
+	VALUES ($1, 1, NOW())
+	ON CONFLICT (key) DO UPDATE SET
+		failures = CASE
+			WHEN login_attempts.last_failure_at < NOW() - INTERVAL '24 hours' THEN 1
+			ELSE login_attempts.failures + 1
+		END,
+		last_failure_at = NOW()
+	RETURNING key, failures, last_failure_at, locked_until`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var attempt LoginAttempt
+	err := m.DB.QueryRowContext(ctx, query, key).Scan(
+		&attempt.Key,
+		&attempt.Failures,
+		&attempt.LastFailureAt,
+		&attempt.LockedUntil,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &attempt, nil
+}
+
+// Lock blocks logins for a key until the given time.
+func (m LoginAttemptModel) Lock(key string, until time.Time) error {
+	query := `
+	UPDATE login_attempts
+	SET locked_until = $2
+	WHERE key = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, key, until)
+	return err
+}
+
+// Reset forgets the failed logins of a key and lifts its lock.
+func (m LoginAttemptModel) Reset(key string) error {
+	query := `
+	DELETE FROM login_attempts
+	WHERE key = $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, key)
+	return err
+}
+
+// DeleteExpired deletes the keys whose failures are no longer counted and whose lock has ended,
+// and returns how many were deleted.
+func (m LoginAttemptModel) DeleteExpired() (int64, error) {
+	query := `
+	DELETE FROM login_attempts
+	WHERE last_failure_at < NOW() - INTERVAL '24 hours'
+	AND (locked_until IS NULL OR locked_until < NOW())`
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
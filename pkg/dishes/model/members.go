@@ -25,6 +25,10 @@ type Member struct {
 	Password  password  `json:"-"`
 	Activated bool      `json:"activated"`
 	Version   int       `json:"-"`
+
+	// Permissions is set when the member was authenticated with a signed token carrying
+	// their permission codes, and nil otherwise.
+	Permissions Permissions `json:"-"`
 }
 
 func (m *Member) IsAnonymous() bool {
@@ -63,6 +67,16 @@ func (p *password) Matches(plaintextPassword string) (bool, error) {
 	return true, nil
 }
 
+// dummyPasswordHash has the same cost as the hashes of real passwords.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy password"), 12)
+
+// CompareDummyPassword does the work of checking a password that never matches. Logins with
+// an unknown email call it, so they take as long as logins with a wrong password and the
+// response time doesn't reveal which emails are registered.
+func CompareDummyPassword(plaintextPassword string) {
+	_ = bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(plaintextPassword))
+}
+
 func ValidateEmail(v *validator.Validator, email string) {
 	v.Check(email != "", "email", "must be provided")
 	v.Check(validator.Matches(email, validator.EmailRX), "email", "must be a valid email address")
@@ -146,6 +160,39 @@ func (m MemberModel) GetByEmail(email string) (*Member, error) {
 	return &member, nil
 }
 
+func (m MemberModel) GetByID(id int64) (*Member, error) {
+	query := `
+		SELECT id, created_at, name, email, password_hash, activated, version
+		FROM members
+		WHERE id = $1`
+
+	var member Member
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&member.ID,
+		&member.CreatedAt,
+		&member.Name,
+		&member.Email,
+		&member.Password.hash,
+		&member.Activated,
+		&member.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &member, nil
+}
+
 func (m MemberModel) Update(member *Member) error {
 	query := `
 		UPDATE members
@@ -181,6 +228,33 @@ func (m MemberModel) Update(member *Member) error {
 	return nil
 }
 
+// Delete removes a member. Their tokens, API keys, permissions, reviews and orders are removed
+// by the database through ON DELETE CASCADE.
+func (m MemberModel) Delete(id int64) error {
+	query := `
+		DELETE FROM members
+		WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
 func (m MemberModel) GetForToken(tokenScope, tokenPlaintext string) (*Member, error) {
 	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
 
@@ -5,6 +5,9 @@ import (
 	"errors"
 	"log"
 	"os"
+	"strconv"
+
+	"github.com/lib/pq"
 )
 
 type Models struct {
@@ -12,8 +15,18 @@ type Models struct {
 	Ingredients IngredientModel
 	Members     MemberModel
 	Tokens      TokenModel
+	Revoked     RevokedTokenModel
+	ApiKeys     ApiKeyModel
+	Logins      LoginAttemptModel
 	Permissions PermissionModel
 	Drinks      DrinkModel
+	Reviews     ReviewModel
+	Orders      OrderModel
+	OrderItems  OrderItemModel
+	Search      SearchModel
+	Trash       TrashModel
+	Audit       AuditModel
+	Prices      PriceModel
 }
 
 var (
@@ -24,6 +37,29 @@ var (
 	ErrEditConflict = errors.New("edit conflict")
 )
 
+// violatedConstraint returns the name of the constraint when err is a unique or foreign key
+// violation reported by PostgreSQL, and "" otherwise.
+func violatedConstraint(err error) string {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return ""
+	}
+
+	switch pqErr.Code.Name() {
+	case "unique_violation", "foreign_key_violation":
+		return pqErr.Constraint
+	default:
+		return ""
+	}
+}
+
+// validID reports whether a numeric ID taken from the URL fits in a bigint column. Larger IDs
+// can't exist, and passing them to PostgreSQL fails the whole query with an out of range error.
+func validID(id string) bool {
+	_, err := strconv.ParseInt(id, 10, 64)
+	return err == nil
+}
+
 func NewModels(db *sql.DB) Models {
 	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
 	errorLog := log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
@@ -47,11 +83,53 @@ func NewModels(db *sql.DB) Models {
 		Tokens: TokenModel{
 			DB: db,
 		},
+		Revoked: RevokedTokenModel{
+			DB: db,
+		},
+		ApiKeys: ApiKeyModel{
+			DB: db,
+		},
+		Logins: LoginAttemptModel{
+			DB: db,
+		},
         Drinks: DrinkModel{ 
 			DB:       db,
 			InfoLog:  infoLog,
 			ErrorLog: errorLog,
 		   },
+		Reviews: ReviewModel{
+			DB:       db,
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+		},
+		Orders: OrderModel{
+			DB:       db,
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+		},
+		OrderItems: OrderItemModel{
+			DB:       db,
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+		},
+		Search: SearchModel{
+			DB:       db,
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+		},
+		Trash: TrashModel{
+			DB:       db,
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+		},
+		Audit: AuditModel{
+			DB: db,
+		},
+		Prices: PriceModel{
+			DB:       db,
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+		},
 	}
 
 }
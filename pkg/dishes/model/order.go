@@ -0,0 +1,340 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/shohin-cloud/dishes-api/pkg/dishes/validator"
+)
+
+const (
+	OrderStatusCart      = "cart"
+	OrderStatusPending   = "pending"
+	OrderStatusPreparing = "preparing"
+	OrderStatusReady     = "ready"
+	OrderStatusServed    = "served"
+	OrderStatusCancelled = "cancelled"
+)
+
+var (
+	// ErrEmptyCart is returned when a member tries to place an order without any items.
+	ErrEmptyCart = errors.New("empty cart")
+
+	// ErrTrashedCartItem is returned when a cart holds a dish or drink that has been moved to
+	// the trash since it was added.
+	ErrTrashedCartItem = errors.New("trashed cart item")
+
+	// ErrInvalidStatusTransition is returned when an order can't move to the requested status.
+	ErrInvalidStatusTransition = errors.New("invalid status transition")
+)
+
+// orderTransitions lists the statuses every order status is allowed to move to. Carts only
+// become pending orders through Checkout.
+var orderTransitions = map[string][]string{
+	OrderStatusPending:   {OrderStatusPreparing, OrderStatusCancelled},
+	OrderStatusPreparing: {OrderStatusReady, OrderStatusCancelled},
+	OrderStatusReady:     {OrderStatusServed},
+}
+
+// Order represents a member's cart or a placed order.
+type Order struct {
+	ID        string       `json:"id"`
+	CreatedAt string       `json:"createdAt"`
+	UpdatedAt string       `json:"updatedAt"`
+	MemberID  int64        `json:"memberId"`
+	Status    string       `json:"status"`
+	Total     float64      `json:"total"`
+	Items     []*OrderItem `json:"items,omitempty"`
+	Version   int          `json:"-"`
+}
+
+// CanTransitionTo reports whether the order is allowed to move to the given status.
+func (o *Order) CanTransitionTo(status string) bool {
+	return validator.In(status, orderTransitions[o.Status]...)
+}
+
+func ValidateOrderStatus(v *validator.Validator, status string) {
+	v.Check(status != "", "status", "must be provided")
+	v.Check(validator.In(status,
+		OrderStatusPending,
+		OrderStatusPreparing,
+		OrderStatusReady,
+		OrderStatusServed,
+		OrderStatusCancelled,
+	), "status", "must be one of pending, preparing, ready, served or cancelled")
+}
+
+// OrderModel manages interactions with the orders table in the database.
+type OrderModel struct {
+	DB       *sql.DB
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+}
+
+// GetOrCreateCart returns the open cart of a member, creating it on first use.
+func (o OrderModel) GetOrCreateCart(memberID int64) (*Order, error) {
+	query := `
+		INSERT INTO orders (member_id, status)
+		VALUES ($1, 'cart')
+		ON CONFLICT (member_id) WHERE status = 'cart' DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := o.DB.ExecContext(ctx, query, memberID)
+	if err != nil {
+		return nil, err
+	}
+
+	query = `
+		SELECT id, createdat, updatedat, member_id, status, total, version
+		FROM orders
+		WHERE member_id = $1 AND status = 'cart'
+	`
+
+	var order Order
+
+	err = o.DB.QueryRowContext(ctx, query, memberID).Scan(
+		&order.ID,
+		&order.CreatedAt,
+		&order.UpdatedAt,
+		&order.MemberID,
+		&order.Status,
+		&order.Total,
+		&order.Version,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &order, nil
+}
+
+// GetById retrieves an order by ID from the database.
+func (o OrderModel) GetById(id string) (*Order, error) {
+	if !validID(id) {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, createdat, updatedat, member_id, status, total, version
+		FROM orders
+		WHERE id = $1
+	`
+	var order Order
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	row := o.DB.QueryRowContext(ctx, query, id)
+	err := row.Scan(&order.ID, &order.CreatedAt, &order.UpdatedAt, &order.MemberID, &order.Status, &order.Total, &order.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &order, nil
+}
+
+// GetAll retrieves placed orders, optionally narrowed down to the order history of a single
+// member. Carts are never included.
+func (o OrderModel) GetAll(memberID int64, status string, filters Filters) ([]*Order, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, createdAt, updatedAt, member_id, status, total, version
+		FROM orders
+		WHERE (member_id = $1 OR $1 = 0)
+		AND status <> 'cart'
+		AND (status = $2 OR $2 = '')
+		ORDER BY %s %s, id ASC
+		LIMIT $3 OFFSET $4
+	`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{memberID, status, filters.limit(), filters.offset()}
+
+	rows, err := o.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	orders := []*Order{}
+
+	for rows.Next() {
+		var order Order
+
+		err := rows.Scan(
+			&totalRecords,
+			&order.ID,
+			&order.CreatedAt,
+			&order.UpdatedAt,
+			&order.MemberID,
+			&order.Status,
+			&order.Total,
+			&order.Version,
+		)
+
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		orders = append(orders, &order)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return orders, metadata, nil
+}
+
+// Checkout turns a cart into a pending order. The current dish and drink prices are copied
+// onto the order items so later price changes don't affect placed orders.
+func (o OrderModel) Checkout(order *Order) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := o.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The cart is locked first, so items can't be added or changed while it is placed.
+	query := `
+		SELECT 1
+		FROM orders
+		WHERE id = $1 AND status = 'cart' AND version = $2
+		FOR UPDATE
+	`
+
+	var locked int
+
+	err = tx.QueryRowContext(ctx, query, order.ID, order.Version).Scan(&locked)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	query = `
+		SELECT EXISTS (
+			SELECT 1
+			FROM order_items
+			LEFT JOIN dishes ON dishes.id = order_items.dish_id
+			LEFT JOIN drinks ON drinks.id = order_items.drink_id
+			WHERE order_items.order_id = $1
+			AND (dishes.deleted_at IS NOT NULL OR drinks.deleted_at IS NOT NULL)
+		)
+	`
+
+	var trashed bool
+
+	err = tx.QueryRowContext(ctx, query, order.ID).Scan(&trashed)
+	if err != nil {
+		return err
+	}
+
+	if trashed {
+		return ErrTrashedCartItem
+	}
+
+	query = `
+		UPDATE order_items
+		SET unit_price = COALESCE(dishes.price, drinks.price), updatedat = NOW()
+		FROM order_items AS items
+		LEFT JOIN dishes ON dishes.id = items.dish_id
+		LEFT JOIN drinks ON drinks.id = items.drink_id
+		WHERE order_items.id = items.id
+		AND order_items.order_id = $1
+	`
+
+	result, err := tx.ExecContext(ctx, query, order.ID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrEmptyCart
+	}
+
+	query = `
+		UPDATE orders
+		SET status = 'pending',
+			total = (SELECT SUM(unit_price * quantity) FROM order_items WHERE order_id = $1),
+			updatedat = NOW(),
+			version = version + 1
+		WHERE id = $1 AND status = 'cart' AND version = $2
+		RETURNING status, total, updatedat, version
+	`
+
+	err = tx.QueryRowContext(ctx, query, order.ID, order.Version).Scan(
+		&order.Status,
+		&order.Total,
+		&order.UpdatedAt,
+		&order.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// UpdateStatus moves an order to the given status, guarding against invalid transitions and
+// concurrent changes.
+func (o OrderModel) UpdateStatus(order *Order, status string) error {
+	if !order.CanTransitionTo(status) {
+		return ErrInvalidStatusTransition
+	}
+
+	query := `
+		UPDATE orders
+		SET status = $1, updatedat = NOW(), version = version + 1
+		WHERE id = $2 AND status = $3 AND version = $4
+		RETURNING status, updatedat, version
+	`
+
+	args := []interface{}{status, order.ID, order.Status, order.Version}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := o.DB.QueryRowContext(ctx, query, args...).Scan(&order.Status, &order.UpdatedAt, &order.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,260 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/shohin-cloud/dishes-api/pkg/dishes/validator"
+)
+
+var (
+	// ErrInvalidOrderItemTarget is returned when the ordered dish or drink doesn't exist.
+	ErrInvalidOrderItemTarget = errors.New("invalid order item target")
+)
+
+// OrderItem represents a single line of an order. UnitPrice follows the current menu price
+// while the order is a cart and is frozen once the order is placed.
+type OrderItem struct {
+	ID        string  `json:"id"`
+	CreatedAt string  `json:"createdAt"`
+	UpdatedAt string  `json:"updatedAt"`
+	OrderID   string  `json:"orderId"`
+	DishID    string  `json:"dishId,omitempty"`
+	DrinkID   string  `json:"drinkId,omitempty"`
+	Name      string  `json:"name"`
+	Quantity  int     `json:"quantity"`
+	UnitPrice float64 `json:"unitPrice"`
+}
+
+func ValidateOrderItem(v *validator.Validator, item *OrderItem) {
+	v.Check(item.Quantity > 0, "quantity", "must be greater than zero")
+	v.Check(item.Quantity <= 100, "quantity", "must be a maximum of 100")
+	v.Check(item.DishID != "" || item.DrinkID != "", "dishId", "either dishId or drinkId must be provided")
+	v.Check(item.DishID == "" || item.DrinkID == "", "dishId", "only one of dishId or drinkId may be provided")
+}
+
+// ItemsTotal sums up the price of the given order items.
+func ItemsTotal(items []*OrderItem) float64 {
+	total := 0.0
+	for _, item := range items {
+		total += item.UnitPrice * float64(item.Quantity)
+	}
+	return total
+}
+
+// OrderItemModel manages interactions with the order_items table in the database.
+type OrderItemModel struct {
+	DB       *sql.DB
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+}
+
+// Insert adds a new item to a cart. It returns ErrEditConflict if the order has been placed
+// since it was read.
+func (o OrderItemModel) Insert(item *OrderItem) error {
+	query := `
+		INSERT INTO order_items (order_id, dish_id, drink_id, quantity)
+		SELECT $1, $2, $3, $4
+		WHERE EXISTS (SELECT 1 FROM orders WHERE id = $1 AND status = 'cart' FOR SHARE)
+		AND NOT EXISTS (SELECT 1 FROM dishes WHERE id = $2 AND deleted_at IS NOT NULL)
+		AND NOT EXISTS (SELECT 1 FROM drinks WHERE id = $3 AND deleted_at IS NOT NULL)
+		RETURNING id, createdat, updatedat
+	`
+	args := []interface{}{item.OrderID, nullableID(item.DishID), nullableID(item.DrinkID), item.Quantity}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := o.DB.QueryRowContext(ctx, query, args...).Scan(&item.ID, &item.CreatedAt, &item.UpdatedAt)
+	if err != nil {
+		switch {
+		// Nothing is inserted when the order is no longer a cart or the dish or drink is in the
+		// trash.
+		case errors.Is(err, sql.ErrNoRows):
+			open, err := o.isCart(ctx, item.OrderID)
+			if err != nil {
+				return err
+			}
+			if !open {
+				return ErrEditConflict
+			}
+			return ErrInvalidOrderItemTarget
+		case violatedConstraint(err) == "order_items_dish_id_fkey",
+			violatedConstraint(err) == "order_items_drink_id_fkey":
+			return ErrInvalidOrderItemTarget
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isCart reports whether the order is still a cart.
+func (o OrderItemModel) isCart(ctx context.Context, orderID string) (bool, error) {
+	query := `
+		SELECT EXISTS (SELECT 1 FROM orders WHERE id = $1 AND status = 'cart')
+	`
+
+	var open bool
+
+	err := o.DB.QueryRowContext(ctx, query, orderID).Scan(&open)
+	if err != nil {
+		return false, err
+	}
+
+	return open, nil
+}
+
+// GetAllForOrder retrieves the items of an order together with the name and price of the
+// referenced dish or drink.
+func (o OrderItemModel) GetAllForOrder(orderID string) ([]*OrderItem, error) {
+	query := `
+		SELECT order_items.id, order_items.createdat, order_items.updatedat, order_items.order_id,
+			order_items.dish_id, order_items.drink_id, COALESCE(dishes.name, drinks.name),
+			order_items.quantity, COALESCE(order_items.unit_price, dishes.price, drinks.price)
+		FROM order_items
+		LEFT JOIN dishes ON dishes.id = order_items.dish_id
+		LEFT JOIN drinks ON drinks.id = order_items.drink_id
+		WHERE order_items.order_id = $1
+		ORDER BY order_items.id ASC
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := o.DB.QueryContext(ctx, query, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	items := []*OrderItem{}
+
+	for rows.Next() {
+		var item OrderItem
+		var dishID, drinkID sql.NullString
+
+		err := rows.Scan(
+			&item.ID,
+			&item.CreatedAt,
+			&item.UpdatedAt,
+			&item.OrderID,
+			&dishID,
+			&drinkID,
+			&item.Name,
+			&item.Quantity,
+			&item.UnitPrice,
+		)
+
+		if err != nil {
+			return nil, err
+		}
+
+		item.DishID = dishID.String
+		item.DrinkID = drinkID.String
+		items = append(items, &item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// GetById retrieves an order item by ID from the database.
+func (o OrderItemModel) GetById(id string) (*OrderItem, error) {
+	if !validID(id) {
+		return nil, ErrRecordNotFound
+	}
+
+	query := `
+		SELECT id, createdat, updatedat, order_id, dish_id, drink_id, quantity
+		FROM order_items
+		WHERE id = $1
+	`
+	var item OrderItem
+	var dishID, drinkID sql.NullString
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	row := o.DB.QueryRowContext(ctx, query, id)
+	err := row.Scan(&item.ID, &item.CreatedAt, &item.UpdatedAt, &item.OrderID, &dishID, &drinkID, &item.Quantity)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	item.DishID = dishID.String
+	item.DrinkID = drinkID.String
+
+	return &item, nil
+}
+
+// UpdateQuantity changes the quantity of a cart item. It returns ErrEditConflict if the item
+// is gone or its order has been placed since it was read.
+func (o OrderItemModel) UpdateQuantity(item *OrderItem) error {
+	query := `
+		UPDATE order_items
+		SET quantity = $1, updatedat = NOW()
+		WHERE id = $2
+		AND EXISTS (SELECT 1 FROM orders WHERE orders.id = order_items.order_id AND status = 'cart' FOR SHARE)
+		RETURNING updatedat
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := o.DB.QueryRowContext(ctx, query, item.Quantity, item.ID).Scan(&item.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete removes an item from a cart. It returns ErrEditConflict if the item is gone or its
+// order has been placed since it was read.
+func (o OrderItemModel) Delete(id string) error {
+	if !validID(id) {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM order_items
+		WHERE id = $1
+		AND EXISTS (SELECT 1 FROM orders WHERE orders.id = order_items.order_id AND status = 'cart' FOR SHARE)
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := o.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
@@ -3,13 +3,45 @@ package model
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"time"
 
 	"github.com/lib/pq"
+	"github.com/shohin-cloud/dishes-api/pkg/dishes/validator"
+)
+
+var (
+	// ErrUnknownRole is returned when a role code doesn't exist in the database.
+	ErrUnknownRole = errors.New("unknown role")
 )
 
 type Permissions []string
 
+const (
+	RoleAdmin    = "admin"
+	RoleStaff    = "staff"
+	RoleCustomer = "customer"
+)
+
+// Roles lists every role. Each role bundles a set of permission codes, see the roles
+// migration for what they grant.
+var Roles = []string{RoleAdmin, RoleStaff, RoleCustomer}
+
+func ValidateRoles(v *validator.Validator, roles []string) {
+	for _, role := range roles {
+		v.Check(validator.In(role, Roles...), "roles", "must only contain admin, staff or customer")
+	}
+	v.Check(validator.Unique(roles), "roles", "must not contain duplicate values")
+}
+
+func ValidatePermissionCodes(v *validator.Validator, codes []string, known Permissions) {
+	v.Check(len(codes) > 0, "permissions", "must contain at least one entry")
+	for _, code := range codes {
+		v.Check(known.Include(code), "permissions", "must only contain existing permission codes")
+	}
+	v.Check(validator.Unique(codes), "permissions", "must not contain duplicate values")
+}
+
 func (p Permissions) Include(code string) bool {
 	for i := range p {
 		if code == p[i] {
@@ -23,24 +55,80 @@ type PermissionModel struct {
 	DB *sql.DB
 }
 
+// GetAllForMember returns the effective permissions of a member: the ones granted directly
+// and the ones bundled by the member's roles.
 func (m PermissionModel) GetAllForMember(memberID int64) (Permissions, error) {
 	query := `
 	SELECT permissions.code
 	FROM permissions
 	INNER JOIN members_permissions ON members_permissions.permission_id = permissions.id
-	INNER JOIN members ON members_permissions.member_id = members.id
-	WHERE members.id = $1`
+	WHERE members_permissions.member_id = $1
+	UNION
+	SELECT permissions.code
+	FROM permissions
+	INNER JOIN roles_permissions ON roles_permissions.permission_id = permissions.id
+	INNER JOIN members_roles ON members_roles.role_id = roles_permissions.role_id
+	WHERE members_roles.member_id = $1
+	ORDER BY code`
+	return m.queryCodes(query, memberID)
+}
+
+// GetDirectForMember returns only the permissions granted to a member directly.
+func (m PermissionModel) GetDirectForMember(memberID int64) (Permissions, error) {
+	query := `
+	SELECT permissions.code
+	FROM permissions
+	INNER JOIN members_permissions ON members_permissions.permission_id = permissions.id
+	WHERE members_permissions.member_id = $1
+	ORDER BY permissions.code`
+	return m.queryCodes(query, memberID)
+}
+
+// GetFromRolesForMember returns only the permissions bundled by the member's roles.
+func (m PermissionModel) GetFromRolesForMember(memberID int64) (Permissions, error) {
+	query := `
+	SELECT DISTINCT permissions.code
+	FROM permissions
+	INNER JOIN roles_permissions ON roles_permissions.permission_id = permissions.id
+	INNER JOIN members_roles ON members_roles.role_id = roles_permissions.role_id
+	WHERE members_roles.member_id = $1
+	ORDER BY permissions.code`
+	return m.queryCodes(query, memberID)
+}
+
+// GetAll returns every permission code known to the application.
+func (m PermissionModel) GetAll() (Permissions, error) {
+	query := `
+	SELECT code
+	FROM permissions
+	ORDER BY code`
+	return m.queryCodes(query)
+}
+
+// GetRolesForMember returns the roles assigned to a member.
+func (m PermissionModel) GetRolesForMember(memberID int64) ([]string, error) {
+	query := `
+	SELECT roles.code
+	FROM roles
+	INNER JOIN members_roles ON members_roles.role_id = roles.id
+	WHERE members_roles.member_id = $1
+	ORDER BY roles.code`
+	return m.queryCodes(query, memberID)
+}
+
+// queryCodes runs a query selecting a single code column and collects the results.
+func (m PermissionModel) queryCodes(query string, args ...interface{}) (Permissions, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := m.DB.QueryContext(ctx, query, memberID)
+	rows, err := m.DB.QueryContext(ctx, query, args...)
 
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var permissions Permissions
+	permissions := Permissions{}
 
 	for rows.Next() {
 		var permission string
@@ -61,9 +149,60 @@ func (m PermissionModel) GetAllForMember(memberID int64) (Permissions, error) {
 func (m PermissionModel) AddForMember(memberID int64, codes ...string) error {
 	query := `
 	INSERT INTO members_permissions
-	SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)`
+	SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)
+	ON CONFLICT DO NOTHING`
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 	_, err := m.DB.ExecContext(ctx, query, memberID, pq.Array(codes))
 	return err
 }
+
+// RemoveForMember revokes permissions granted directly to a member. Permissions bundled by
+// the member's roles are not affected.
+func (m PermissionModel) RemoveForMember(memberID int64, codes ...string) error {
+	query := `
+	DELETE FROM members_permissions
+	USING permissions
+	WHERE members_permissions.permission_id = permissions.id
+	AND members_permissions.member_id = $1
+	AND permissions.code = ANY($2)`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, memberID, pq.Array(codes))
+	return err
+}
+
+// SetRoles replaces the roles of a member with the given ones.
+func (m PermissionModel) SetRoles(memberID int64, roles ...string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM members_roles WHERE member_id = $1`, memberID)
+	if err != nil {
+		return err
+	}
+
+	query := `
+	INSERT INTO members_roles
+	SELECT $1, roles.id FROM roles WHERE roles.code = ANY($2)`
+	result, err := tx.ExecContext(ctx, query, memberID, pq.Array(roles))
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if int(rowsAffected) != len(roles) {
+		return ErrUnknownRole
+	}
+
+	return tx.Commit()
+}
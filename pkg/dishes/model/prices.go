@@ -0,0 +1,482 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/shohin-cloud/dishes-api/pkg/dishes/validator"
+)
+
+// Statuses of a scheduled price.
+const (
+	ScheduleStatusPending   = "pending"
+	ScheduleStatusActive    = "active"
+	ScheduleStatusCompleted = "completed"
+	ScheduleStatusSkipped   = "skipped"
+	ScheduleStatusCancelled = "cancelled"
+)
+
+// ErrScheduleOverlap is returned when a scheduled price overlaps another pending or active
+// schedule of the same item.
+var ErrScheduleOverlap = errors.New("schedule overlap")
+
+// priceTarget is the table of a priced item type and the column other tables refer to it by.
+type priceTarget struct {
+	table  string
+	column string
+}
+
+// priceTargets maps the item types that have a price to their tables.
+var priceTargets = map[string]priceTarget{
+	"dish":  {table: "dishes", column: "dish_id"},
+	"drink": {table: "drinks", column: "drink_id"},
+}
+
+// PriceChange is an entry in the price history of a dish or drink. PreviousPrice is missing
+// for the price the item was created with.
+type PriceChange struct {
+	ID            string   `json:"id"`
+	CreatedAt     string   `json:"createdAt"`
+	Price         float64  `json:"price"`
+	PreviousPrice *float64 `json:"previousPrice"`
+}
+
+// ScheduledPrice is a price a dish or drink gets at EffectiveFrom. Without EffectiveTo the
+// change is permanent, otherwise PreviousPrice comes back at EffectiveTo.
+type ScheduledPrice struct {
+	ID            string     `json:"id"`
+	CreatedAt     string     `json:"createdAt"`
+	DishID        string     `json:"dishId,omitempty"`
+	DrinkID       string     `json:"drinkId,omitempty"`
+	Price         float64    `json:"price"`
+	EffectiveFrom time.Time  `json:"effectiveFrom"`
+	EffectiveTo   *time.Time `json:"effectiveTo"`
+	Status        string     `json:"status"`
+	PreviousPrice *float64   `json:"previousPrice"`
+}
+
+// PriceModel manages the price history and the scheduled prices of dishes and drinks.
+type PriceModel struct {
+	DB       *sql.DB
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+}
+
+func ValidateScheduledPrice(v *validator.Validator, s *ScheduledPrice, now time.Time) {
+	v.Check(s.Price > 0, "price", "must be greater than zero")
+	v.Check(s.Price < 100000000, "price", "must be less than 100000000")
+	v.Check(!s.EffectiveFrom.IsZero(), "effectiveFrom", "must be provided")
+	v.Check(s.EffectiveFrom.After(now), "effectiveFrom", "must be in the future")
+	v.Check(s.EffectiveTo == nil || s.EffectiveTo.After(s.EffectiveFrom), "effectiveTo", "must be after effectiveFrom")
+}
+
+// setItemID sets the dish or drink ID of the schedule, depending on the item type.
+func (s *ScheduledPrice) setItemID(itemType, id string) {
+	switch itemType {
+	case "dish":
+		s.DishID = id
+	case "drink":
+		s.DrinkID = id
+	}
+}
+
+// GetHistory lists the price changes of a dish or drink.
+func (m PriceModel) GetHistory(itemType, id string, filters Filters) ([]*PriceChange, Metadata, error) {
+	target, ok := priceTargets[itemType]
+	if !ok {
+		return nil, Metadata{}, ErrRecordNotFound
+	}
+
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, createdat, price, previous_price
+		FROM price_history
+		WHERE %s = $1
+		ORDER BY %s %s, id DESC
+		LIMIT $2 OFFSET $3
+	`, target.column, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, id, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	changes := []*PriceChange{}
+
+	for rows.Next() {
+		var change PriceChange
+
+		err := rows.Scan(
+			&totalRecords,
+			&change.ID,
+			&change.CreatedAt,
+			&change.Price,
+			&change.PreviousPrice,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		changes = append(changes, &change)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return changes, metadata, nil
+}
+
+// InsertSchedule schedules a price for a dish or drink. A permanent change counts as the
+// instant it takes effect, so it can't fall inside the window of another schedule.
+func (m PriceModel) InsertSchedule(itemType, id string, s *ScheduledPrice) error {
+	target, ok := priceTargets[itemType]
+	if !ok {
+		return ErrRecordNotFound
+	}
+
+	query := fmt.Sprintf(`
+		INSERT INTO scheduled_prices (%[1]s, price, effective_from, effective_to)
+		SELECT $1::bigint, $2::numeric, $3::timestamptz, $4::timestamptz
+		WHERE NOT EXISTS (
+			SELECT 1 FROM scheduled_prices
+			WHERE %[1]s = $1::bigint
+			AND status IN ('pending', 'active')
+			AND tstzrange(effective_from, COALESCE(effective_to, effective_from), CASE WHEN effective_to IS NULL THEN '[]' ELSE '[)' END)
+				&& tstzrange($3::timestamptz, COALESCE($4::timestamptz, $3::timestamptz), CASE WHEN $4::timestamptz IS NULL THEN '[]' ELSE '[)' END)
+		)
+		RETURNING id, createdat, status
+	`, target.column)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{id, s.Price, s.EffectiveFrom, s.EffectiveTo}
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&s.ID, &s.CreatedAt, &s.Status)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrScheduleOverlap
+		default:
+			return err
+		}
+	}
+
+	s.setItemID(itemType, id)
+
+	return nil
+}
+
+// GetSchedules lists the scheduled prices of a dish or drink, the next to take effect first.
+func (m PriceModel) GetSchedules(itemType, id string) ([]*ScheduledPrice, error) {
+	target, ok := priceTargets[itemType]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	query := fmt.Sprintf(`
+		SELECT id, createdat, price, effective_from, effective_to, status, previous_price
+		FROM scheduled_prices
+		WHERE %s = $1
+		ORDER BY effective_from ASC, id ASC
+	`, target.column)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	schedules := []*ScheduledPrice{}
+
+	for rows.Next() {
+		var s ScheduledPrice
+
+		err := rows.Scan(
+			&s.ID,
+			&s.CreatedAt,
+			&s.Price,
+			&s.EffectiveFrom,
+			&s.EffectiveTo,
+			&s.Status,
+			&s.PreviousPrice,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		s.setItemID(itemType, id)
+		schedules = append(schedules, &s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return schedules, nil
+}
+
+// CancelSchedule cancels a scheduled price that hasn't taken effect yet.
+func (m PriceModel) CancelSchedule(itemType, id, scheduleID string) (*ScheduledPrice, error) {
+	target, ok := priceTargets[itemType]
+	if !ok || !validID(id) || !validID(scheduleID) {
+		return nil, ErrRecordNotFound
+	}
+
+	query := fmt.Sprintf(`
+		UPDATE scheduled_prices
+		SET status = 'cancelled'
+		WHERE id = $1 AND %s = $2 AND status = 'pending'
+		RETURNING id, createdat, price, effective_from, effective_to, status, previous_price
+	`, target.column)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var s ScheduledPrice
+
+	err := m.DB.QueryRowContext(ctx, query, scheduleID, id).Scan(
+		&s.ID,
+		&s.CreatedAt,
+		&s.Price,
+		&s.EffectiveFrom,
+		&s.EffectiveTo,
+		&s.Status,
+		&s.PreviousPrice,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	s.setItemID(itemType, id)
+
+	return &s, nil
+}
+
+// ApplyDue applies the scheduled prices that are due at now and returns how many prices it
+// changed. Windows that have ended give the item its previous price back, unless the price
+// was changed by hand in the meantime. Schedules whose window passed before they could be
+// applied, or whose item is in the trash, are skipped.
+func (m PriceModel) ApplyDue(now time.Time) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	defer tx.Rollback()
+
+	changed := 0
+
+	for _, itemType := range []string{"dish", "drink"} {
+		n, err := applyDue(ctx, tx, priceTargets[itemType], now)
+		if err != nil {
+			return 0, err
+		}
+
+		changed += n
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return changed, nil
+}
+
+// dueSchedule is a scheduled price picked up by applyDue.
+type dueSchedule struct {
+	id            int64
+	itemID        int64
+	price         float64
+	effectiveTo   *time.Time
+	previousPrice *float64
+}
+
+// applyDue applies the due schedules of one item type.
+func applyDue(ctx context.Context, tx *sql.Tx, target priceTarget, now time.Time) (int, error) {
+	query := fmt.Sprintf(`
+		UPDATE scheduled_prices
+		SET status = 'skipped'
+		WHERE %s IS NOT NULL AND status = 'pending' AND effective_to <= $1
+	`, target.column)
+
+	_, err := tx.ExecContext(ctx, query, now)
+	if err != nil {
+		return 0, err
+	}
+
+	changed := 0
+
+	// Windows end before new schedules start, so a window starting right as another one ends
+	// replaces the restored price.
+	ending, err := dueSchedules(ctx, tx, target, ScheduleStatusActive, "effective_to", now)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, s := range ending {
+		var ok bool
+		if s.previousPrice != nil {
+			_, ok, err = setPrice(ctx, tx, target, s.itemID, *s.previousPrice, &s.price)
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		if ok {
+			changed++
+		}
+
+		err = setScheduleStatus(ctx, tx, s.id, ScheduleStatusCompleted, s.previousPrice)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	starting, err := dueSchedules(ctx, tx, target, ScheduleStatusPending, "effective_from", now)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, s := range starting {
+		previous, ok, err := setPrice(ctx, tx, target, s.itemID, s.price, nil)
+		if err != nil {
+			return 0, err
+		}
+
+		status := ScheduleStatusSkipped
+		switch {
+		case ok && s.effectiveTo != nil:
+			status = ScheduleStatusActive
+			changed++
+		case ok:
+			status = ScheduleStatusCompleted
+			changed++
+		}
+
+		var previousPrice *float64
+		if ok {
+			previousPrice = &previous
+		}
+
+		err = setScheduleStatus(ctx, tx, s.id, status, previousPrice)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return changed, nil
+}
+
+// dueSchedules locks and returns the schedules of an item type in the given status whose
+// column is at or before now.
+func dueSchedules(ctx context.Context, tx *sql.Tx, target priceTarget, status, column string, now time.Time) ([]*dueSchedule, error) {
+	query := fmt.Sprintf(`
+		SELECT id, %[1]s, price, effective_to, previous_price
+		FROM scheduled_prices
+		WHERE %[1]s IS NOT NULL AND status = $1 AND %[2]s <= $2
+		ORDER BY %[2]s ASC, id ASC
+		FOR UPDATE
+	`, target.column, column)
+
+	rows, err := tx.QueryContext(ctx, query, status, now)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	schedules := []*dueSchedule{}
+
+	for rows.Next() {
+		var s dueSchedule
+
+		err := rows.Scan(&s.id, &s.itemID, &s.price, &s.effectiveTo, &s.previousPrice)
+		if err != nil {
+			return nil, err
+		}
+
+		schedules = append(schedules, &s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return schedules, nil
+}
+
+// setPrice changes the price of a dish or drink that isn't in the trash and records the change
+// in the price history. With ifPrice the price is only changed while it still is *ifPrice. It
+// returns the price the item had, and false when the item wasn't changed.
+func setPrice(ctx context.Context, tx *sql.Tx, target priceTarget, itemID int64, price float64, ifPrice *float64) (float64, bool, error) {
+	query := fmt.Sprintf(`
+		WITH old AS (
+			SELECT id, price FROM %[1]s
+			WHERE id = $2 AND deleted_at IS NULL AND ($3::numeric IS NULL OR price = $3)
+			FOR UPDATE
+		), updated AS (
+			UPDATE %[1]s
+			SET price = $1, updatedat = NOW(), version = version + 1
+			WHERE id IN (SELECT id FROM old)
+			RETURNING id, price
+		), history AS (
+			INSERT INTO price_history (%[2]s, price, previous_price)
+			SELECT updated.id, updated.price, old.price
+			FROM updated
+			INNER JOIN old ON old.id = updated.id
+			WHERE updated.price <> old.price
+		)
+		SELECT price FROM old
+	`, target.table, target.column)
+
+	var previous float64
+
+	err := tx.QueryRowContext(ctx, query, price, itemID, ifPrice).Scan(&previous)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, false, nil
+		default:
+			return 0, false, err
+		}
+	}
+
+	return previous, true, nil
+}
+
+// setScheduleStatus moves a schedule to the given status.
+func setScheduleStatus(ctx context.Context, tx *sql.Tx, id int64, status string, previousPrice *float64) error {
+	query := `
+		UPDATE scheduled_prices
+		SET status = $1, previous_price = $2
+		WHERE id = $3
+	`
+
+	_, err := tx.ExecContext(ctx, query, status, previousPrice, id)
+	return err
+}
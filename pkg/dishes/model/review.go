@@ -0,0 +1,279 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/shohin-cloud/dishes-api/pkg/dishes/validator"
+)
+
+var (
+	// ErrDuplicateReview is returned when a member reviews the same dish or drink twice.
+	ErrDuplicateReview = errors.New("duplicate review")
+
+	// ErrInvalidReviewTarget is returned when the reviewed dish or drink doesn't exist.
+	ErrInvalidReviewTarget = errors.New("invalid review target")
+)
+
+// Review represents a member's rating of a single dish or drink.
+type Review struct {
+	ID        string `json:"id"`
+	CreatedAt string `json:"createdAt"`
+	UpdatedAt string `json:"updatedAt"`
+	MemberID  int64  `json:"memberId"`
+	DishID    string `json:"dishId,omitempty"`
+	DrinkID   string `json:"drinkId,omitempty"`
+	Rating    int    `json:"rating"`
+	Comment   string `json:"comment"`
+}
+
+// ReviewModel manages interactions with the reviews table in the database.
+type ReviewModel struct {
+	DB       *sql.DB
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+}
+
+func ValidateReview(v *validator.Validator, review *Review) {
+	v.Check(review.Rating >= 1 && review.Rating <= 5, "rating", "must be between 1 and 5")
+	v.Check(len(review.Comment) <= 1000, "comment", "must not be more than 1000 bytes long")
+	v.Check(review.DishID != "" || review.DrinkID != "", "dishId", "either dishId or drinkId must be provided")
+	v.Check(review.DishID == "" || review.DrinkID == "", "dishId", "only one of dishId or drinkId may be provided")
+}
+
+// nullableID converts an empty identifier into a NULL database value.
+func nullableID(id string) interface{} {
+	if id == "" {
+		return nil
+	}
+	return id
+}
+
+// Insert inserts a new review into the database.
+func (r ReviewModel) Insert(review *Review) error {
+	query := `
+		INSERT INTO reviews (member_id, dish_id, drink_id, rating, comment)
+		SELECT $1, $2, $3, $4, $5
+		WHERE NOT EXISTS (SELECT 1 FROM dishes WHERE id = $2 AND deleted_at IS NOT NULL)
+		AND NOT EXISTS (SELECT 1 FROM drinks WHERE id = $3 AND deleted_at IS NOT NULL)
+		RETURNING id, createdat, updatedat
+	`
+	args := []interface{}{review.MemberID, nullableID(review.DishID), nullableID(review.DrinkID), review.Rating, review.Comment}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := r.DB.QueryRowContext(ctx, query, args...).Scan(&review.ID, &review.CreatedAt, &review.UpdatedAt)
+	if err != nil {
+		// Nothing is inserted when the dish or drink is in the trash.
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrInvalidReviewTarget
+		}
+
+		switch violatedConstraint(err) {
+		case "reviews_member_dish_key", "reviews_member_drink_key":
+			return ErrDuplicateReview
+		case "reviews_dish_id_fkey", "reviews_drink_id_fkey":
+			return ErrInvalidReviewTarget
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// reviewTargetNotTrashed is the condition hiding the reviews of trashed dishes and drinks.
+const reviewTargetNotTrashed = `
+		NOT EXISTS (SELECT 1 FROM dishes WHERE dishes.id = reviews.dish_id AND dishes.deleted_at IS NOT NULL)
+		AND NOT EXISTS (SELECT 1 FROM drinks WHERE drinks.id = reviews.drink_id AND drinks.deleted_at IS NOT NULL)`
+
+// GetAll retrieves reviews, optionally narrowed down to a single dish or drink. Reviews of
+// trashed dishes and drinks are left out.
+func (r ReviewModel) GetAll(dishID int, drinkID int, filters Filters) ([]*Review, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), id, createdAt, updatedAt, member_id, dish_id, drink_id, rating, comment
+		FROM reviews
+		WHERE (dish_id = $1 OR $1 = 0)
+		AND (drink_id = $2 OR $2 = 0)
+		AND %s
+		ORDER BY %s %s, id ASC
+		LIMIT $3 OFFSET $4
+	`, reviewTargetNotTrashed, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{dishID, drinkID, filters.limit(), filters.offset()}
+
+	rows, err := r.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	reviews := []*Review{}
+
+	for rows.Next() {
+		var review Review
+		var dishID, drinkID sql.NullString
+
+		err := rows.Scan(
+			&totalRecords,
+			&review.ID,
+			&review.CreatedAt,
+			&review.UpdatedAt,
+			&review.MemberID,
+			&dishID,
+			&drinkID,
+			&review.Rating,
+			&review.Comment,
+		)
+
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		review.DishID = dishID.String
+		review.DrinkID = drinkID.String
+		reviews = append(reviews, &review)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return reviews, metadata, nil
+}
+
+// GetById retrieves a review by ID from the database. Reviews of trashed dishes and drinks
+// are treated as missing.
+func (r ReviewModel) GetById(id string) (*Review, error) {
+	if !validID(id) {
+		return nil, ErrRecordNotFound
+	}
+
+	query := fmt.Sprintf(`
+		SELECT id, createdat, updatedat, member_id, dish_id, drink_id, rating, comment
+		FROM reviews
+		WHERE id = $1
+		AND %s
+	`, reviewTargetNotTrashed)
+	var review Review
+	var dishID, drinkID sql.NullString
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	row := r.DB.QueryRowContext(ctx, query, id)
+	err := row.Scan(&review.ID, &review.CreatedAt, &review.UpdatedAt, &review.MemberID, &dishID, &drinkID, &review.Rating, &review.Comment)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	review.DishID = dishID.String
+	review.DrinkID = drinkID.String
+
+	return &review, nil
+}
+
+// Update updates the rating and comment of a review.
+func (r ReviewModel) Update(review *Review) error {
+	query := `
+		UPDATE reviews
+		SET rating = $1, comment = $2, updatedat = NOW()
+		WHERE id = $3
+		RETURNING updatedat
+	`
+
+	args := []interface{}{review.Rating, review.Comment, review.ID}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := r.DB.QueryRowContext(ctx, query, args...).Scan(&review.UpdatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Delete deletes a review from the database.
+func (r ReviewModel) Delete(id string) error {
+	if !validID(id) {
+		return ErrRecordNotFound
+	}
+
+	query := `
+		DELETE FROM reviews
+		WHERE id = $1
+	`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := r.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// RatingForDish returns the average rating and the number of reviews of a dish.
+func (r ReviewModel) RatingForDish(dishID string) (float64, int, error) {
+	return r.rating("dish_id", dishID)
+}
+
+// RatingForDrink returns the average rating and the number of reviews of a drink.
+func (r ReviewModel) RatingForDrink(drinkID string) (float64, int, error) {
+	return r.rating("drink_id", drinkID)
+}
+
+// rating aggregates the reviews matching the given target column. The column is never
+// taken from user input.
+func (r ReviewModel) rating(column string, id string) (float64, int, error) {
+	query := fmt.Sprintf(`
+		SELECT COALESCE(ROUND(AVG(rating), 2), 0), count(*)
+		FROM reviews
+		WHERE %s = $1
+	`, column)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var average float64
+	var count int
+
+	err := r.DB.QueryRowContext(ctx, query, id).Scan(&average, &count)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return average, count, nil
+}
@@ -0,0 +1,68 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// RevokedTokenModel manages the denylist of signed tokens which were revoked before they
+// expired. Entries are JWT IDs or session IDs and are kept until the expiry of the last token
+// they could match.
+type RevokedTokenModel struct {
+	DB *sql.DB
+}
+
+// Insert adds an ID to the denylist.
+func (m RevokedTokenModel) Insert(id string, expiry time.Time) error {
+	query := `
+	INSERT INTO revoked_tokens (id, expiry)
+	VALUES ($1, $2)
+	ON CONFLICT (id) DO UPDATE SET expiry = GREATEST(revoked_tokens.expiry, EXCLUDED.expiry)`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, id, expiry)
+	return err
+}
+
+// GetAllActive returns the denylisted IDs which haven't expired yet.
+func (m RevokedTokenModel) GetAllActive() (map[string]time.Time, error) {
+	query := `
+	SELECT id, expiry
+	FROM revoked_tokens
+	WHERE expiry > $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revoked := make(map[string]time.Time)
+	for rows.Next() {
+		var id string
+		var expiry time.Time
+		if err := rows.Scan(&id, &expiry); err != nil {
+			return nil, err
+		}
+		revoked[id] = expiry
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return revoked, nil
+}
+
+// DeleteExpired removes denylist entries which can no longer match a valid token.
+func (m RevokedTokenModel) DeleteExpired() error {
+	query := `
+	DELETE FROM revoked_tokens
+	WHERE expiry <= $1`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, time.Now())
+	return err
+}
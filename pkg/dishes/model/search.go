@@ -0,0 +1,112 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/shohin-cloud/dishes-api/pkg/dishes/validator"
+)
+
+const (
+	SearchTypeDish  = "dish"
+	SearchTypeDrink = "drink"
+)
+
+// SearchResult is a single dish or drink matched by a catalog search. Type tells them apart.
+type SearchResult struct {
+	Type        string  `json:"type"`
+	ID          string  `json:"id"`
+	CreatedAt   string  `json:"createdAt"`
+	UpdatedAt   string  `json:"updatedAt"`
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Price       float64 `json:"price"`
+	Relevance   float64 `json:"relevance"`
+}
+
+// SearchModel runs full-text and fuzzy searches across dishes and drinks.
+type SearchModel struct {
+	DB       *sql.DB
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+}
+
+func ValidateSearchQuery(v *validator.Validator, query string) {
+	v.Check(query != "", "q", "must be provided")
+	v.Check(len(query) <= 200, "q", "must not be more than 200 bytes long")
+}
+
+// Search matches the query against the name and description of dishes and drinks using
+// PostgreSQL full-text search, falling back to trigram similarity on the name so that
+// misspelled queries still find something. Only results of the given types are returned.
+func (s SearchModel) Search(q string, types []string, filters Filters) ([]*SearchResult, Metadata, error) {
+	query := fmt.Sprintf(`
+		WITH results AS (
+			SELECT 'dish' AS type, id, createdAt, updatedAt, name, description, price,
+				ts_rank(search_vector, plainto_tsquery('english', $1)) + similarity(name, $1) AS relevance
+			FROM dishes
+			WHERE deleted_at IS NULL
+			AND (search_vector @@ plainto_tsquery('english', $1) OR name %% $1 OR $1 <%% name)
+			UNION ALL
+			SELECT 'drink' AS type, id, createdAt, updatedAt, name, description, price,
+				ts_rank(search_vector, plainto_tsquery('english', $1)) + similarity(name, $1) AS relevance
+			FROM drinks
+			WHERE deleted_at IS NULL
+			AND (search_vector @@ plainto_tsquery('english', $1) OR name %% $1 OR $1 <%% name)
+		)
+		SELECT count(*) OVER(), type, id, createdAt, updatedAt, name, description, price, relevance
+		FROM results
+		WHERE type = ANY($4)
+		ORDER BY %s %s, type ASC, id ASC
+		LIMIT $2 OFFSET $3
+	`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{q, filters.limit(), filters.offset(), pq.Array(types)}
+
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	results := []*SearchResult{}
+
+	for rows.Next() {
+		var result SearchResult
+
+		err := rows.Scan(
+			&totalRecords,
+			&result.Type,
+			&result.ID,
+			&result.CreatedAt,
+			&result.UpdatedAt,
+			&result.Name,
+			&result.Description,
+			&result.Price,
+			&result.Relevance,
+		)
+
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		results = append(results, &result)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return results, metadata, nil
+}
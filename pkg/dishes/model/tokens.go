@@ -6,6 +6,8 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"encoding/base32"
+	"encoding/hex"
+	"errors"
 	"time"
 
 	"github.com/shohin-cloud/dishes-api/pkg/dishes/validator"
@@ -14,6 +16,8 @@ import (
 const (
 	ScopeActivation     = "activation"
 	ScopeAuthentication = "authentication"
+	ScopePasswordReset  = "password-reset"
+	ScopeRefresh        = "refresh"
 )
 
 type Token struct {
@@ -22,6 +26,29 @@ type Token struct {
 	MemberID  int64     `json:"-"`
 	Expiry    time.Time `json:"expiry"`
 	Scope     string    `json:"-"`
+
+	// Session groups the authentication and refresh tokens issued by a single login.
+	Session   string    `json:"-"`
+	UserAgent string    `json:"-"`
+	IP        string    `json:"-"`
+	CreatedAt time.Time `json:"-"`
+}
+
+// Session describes a login of a member as listed by GET /members/me/sessions.
+type Session struct {
+	ID         string     `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Expiry     time.Time  `json:"expiry"`
+	UserAgent  string     `json:"user_agent"`
+	IP         string     `json:"ip"`
+	Current    bool       `json:"current"`
+}
+
+// SessionMetadata is the client information recorded with the tokens of a session.
+type SessionMetadata struct {
+	UserAgent string
+	IP        string
 }
 
 func generateToken(memberID int64, ttl time.Duration, scope string) (*Token, error) {
@@ -30,17 +57,28 @@ func generateToken(memberID int64, ttl time.Duration, scope string) (*Token, err
 		Expiry:   time.Now().Add(ttl),
 		Scope:    scope,
 	}
-	randomBytes := make([]byte, 16)
-	_, err := rand.Read(randomBytes)
+	var err error
+	token.Plaintext, token.Hash, err = generateSecret(16)
 	if err != nil {
 		return nil, err
 	}
-	token.Plaintext = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
-	hash := sha256.Sum256([]byte(token.Plaintext))
-	token.Hash = hash[:]
+	token.Session = hex.EncodeToString(token.Hash)
 	return token, nil
 }
 
+// generateSecret returns a base32 encoded secret made of n random bytes together with its
+// SHA-256 hash, which is what gets stored.
+func generateSecret(n int) (string, []byte, error) {
+	randomBytes := make([]byte, n)
+	_, err := rand.Read(randomBytes)
+	if err != nil {
+		return "", nil, err
+	}
+	plaintext := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randomBytes)
+	hash := sha256.Sum256([]byte(plaintext))
+	return plaintext, hash[:], nil
+}
+
 func ValidateTokenPlaintext(v *validator.Validator, tokenPlaintext string) {
 	v.Check(tokenPlaintext != "", "token", "must be provided")
 	v.Check(len(tokenPlaintext) == 26, "token", "must be 26 bytes long")
@@ -60,13 +98,205 @@ func (m TokenModel) New(memberID int64, ttl time.Duration, scope string) (*Token
 }
 
 func (m TokenModel) Insert(token *Token) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	return insertToken(ctx, m.DB, token)
+}
+
+// execer is implemented by both *sql.DB and *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func insertToken(ctx context.Context, db execer, token *Token) error {
+	query := `
+	INSERT INTO tokens (hash, member_id, expiry, scope, session, user_agent, ip, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, COALESCE($8, NOW()))`
+	var createdAt *time.Time
+	if !token.CreatedAt.IsZero() {
+		createdAt = &token.CreatedAt
+	}
+	args := []interface{}{token.Hash, token.MemberID, token.Expiry, token.Scope, token.Session, token.UserAgent, token.IP, createdAt}
+	_, err := db.ExecContext(ctx, query, args...)
+	return err
+}
+
+// NewSession starts a new login session for a member and returns its refresh token.
+// Authentication tokens for the session are issued with NewForSession.
+func (m TokenModel) NewSession(memberID int64, refreshTTL time.Duration, meta SessionMetadata) (*Token, error) {
+	refresh, err := generateToken(memberID, refreshTTL, ScopeRefresh)
+	if err != nil {
+		return nil, err
+	}
+	refresh.UserAgent = meta.UserAgent
+	refresh.IP = meta.IP
+	err = m.Insert(refresh)
+	return refresh, err
+}
+
+// NewForSession issues an authentication token in the session of the given refresh token.
+func (m TokenModel) NewForSession(refresh *Token, ttl time.Duration) (*Token, error) {
+	token, err := generateToken(refresh.MemberID, ttl, ScopeAuthentication)
+	if err != nil {
+		return nil, err
+	}
+	token.Session = refresh.Session
+	token.UserAgent = refresh.UserAgent
+	token.IP = refresh.IP
+	token.CreatedAt = refresh.CreatedAt
+	err = m.Insert(token)
+	return token, err
+}
+
+// Rotate exchanges a refresh token for a new one in the same session. The old refresh token
+// and the authentication tokens of the session stop working. ErrRecordNotFound is returned if
+// the refresh token is unknown or expired.
+func (m TokenModel) Rotate(refreshPlaintext string, refreshTTL time.Duration, meta SessionMetadata) (*Token, error) {
+	hash := sha256.Sum256([]byte(refreshPlaintext))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	query := `
+	DELETE FROM tokens
+	WHERE hash = $1 AND scope = $2 AND expiry > $3
+	RETURNING member_id, session, created_at`
+
+	var memberID int64
+	var session string
+	var createdAt time.Time
+
+	err = tx.QueryRowContext(ctx, query, hash[:], ScopeRefresh, time.Now()).Scan(&memberID, &session, &createdAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM tokens WHERE session = $1 AND scope = $2`, session, ScopeAuthentication)
+	if err != nil {
+		return nil, err
+	}
+
+	refresh, err := generateToken(memberID, refreshTTL, ScopeRefresh)
+	if err != nil {
+		return nil, err
+	}
+	refresh.Session = session
+	refresh.UserAgent = meta.UserAgent
+	refresh.IP = meta.IP
+	refresh.CreatedAt = createdAt
+
+	err = insertToken(ctx, tx, refresh)
+	if err != nil {
+		return nil, err
+	}
+
+	return refresh, tx.Commit()
+}
+
+// Touch records that the given authentication token was just used. To avoid a write on every
+// request the timestamp is only moved forward once a minute.
+func (m TokenModel) Touch(tokenPlaintext string, meta SessionMetadata) error {
+	hash := sha256.Sum256([]byte(tokenPlaintext))
+	query := `
+	UPDATE tokens
+	SET last_used_at = NOW(), user_agent = $2, ip = $3
+	WHERE session = (SELECT session FROM tokens WHERE hash = $1)
+	AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	_, err := m.DB.ExecContext(ctx, query, hash[:], meta.UserAgent, meta.IP)
+	return err
+}
+
+// GetSessionsForMember lists the active sessions of a member. The session the given token
+// belongs to is marked as current.
+func (m TokenModel) GetSessionsForMember(memberID int64, currentPlaintext string) ([]*Session, error) {
+	hash := sha256.Sum256([]byte(currentPlaintext))
+	query := `
+	SELECT DISTINCT ON (session) session, created_at, last_used_at, expiry, user_agent, ip,
+		session = COALESCE((SELECT session FROM tokens WHERE hash = $2), '')
+	FROM tokens
+	WHERE member_id = $1
+	AND scope IN ($3, $4)
+	AND expiry > $5
+	ORDER BY session, expiry DESC`
+	args := []interface{}{memberID, hash[:], ScopeAuthentication, ScopeRefresh, time.Now()}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+	for rows.Next() {
+		var session Session
+		err := rows.Scan(
+			&session.ID,
+			&session.CreatedAt,
+			&session.LastUsedAt,
+			&session.Expiry,
+			&session.UserAgent,
+			&session.IP,
+			&session.Current,
+		)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, &session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// DeleteSession revokes all tokens of a member's session.
+func (m TokenModel) DeleteSession(memberID int64, session string) error {
+	query := `
+	DELETE FROM tokens
+	WHERE member_id = $1 AND session = $2 AND scope IN ($3, $4)`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, memberID, session, ScopeAuthentication, ScopeRefresh)
+	if err != nil {
+		return err
+	}
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeleteSessionForToken revokes the session the given authentication token belongs to.
+func (m TokenModel) DeleteSessionForToken(tokenPlaintext string) error {
+	hash := sha256.Sum256([]byte(tokenPlaintext))
 	query := `
-	INSERT INTO tokens (hash, member_id, expiry, scope)
-	VALUES ($1, $2, $3, $4)`
-	args := []interface{}{token.Hash, token.MemberID, token.Expiry, token.Scope}
+	DELETE FROM tokens
+	WHERE session = (SELECT session FROM tokens WHERE hash = $1 AND scope = $2)
+	AND scope IN ($2, $3)`
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
-	_, err := m.DB.ExecContext(ctx, query, args...)
+	_, err := m.DB.ExecContext(ctx, query, hash[:], ScopeAuthentication, ScopeRefresh)
 	return err
 }
 
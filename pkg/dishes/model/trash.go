@@ -0,0 +1,243 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/shohin-cloud/dishes-api/pkg/dishes/validator"
+)
+
+const (
+	TrashTypeDish       = "dish"
+	TrashTypeDrink      = "drink"
+	TrashTypeIngredient = "ingredient"
+)
+
+// ErrRecordInUse is returned when a trashed item can't be purged because placed orders still
+// refer to it.
+var ErrRecordInUse = errors.New("record in use")
+
+// trashTables maps the trash item types to their tables.
+var trashTables = map[string]string{
+	TrashTypeDish:       "dishes",
+	TrashTypeDrink:      "drinks",
+	TrashTypeIngredient: "ingredients",
+}
+
+// orderItemColumns maps the trash item types that order items refer to to their column in
+// order_items.
+var orderItemColumns = map[string]string{
+	TrashTypeDish:  "dish_id",
+	TrashTypeDrink: "drink_id",
+}
+
+// TrashItem is a deleted dish, drink or ingredient. Type tells them apart.
+type TrashItem struct {
+	Type      string `json:"type"`
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	DeletedAt string `json:"deletedAt"`
+}
+
+// TrashModel lists and purges the deleted catalog items.
+type TrashModel struct {
+	DB       *sql.DB
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+}
+
+func ValidateTrashType(v *validator.Validator, itemType string) {
+	v.Check(validator.In(itemType, TrashTypeDish, TrashTypeDrink, TrashTypeIngredient), "type", "must be dish, drink or ingredient")
+}
+
+// GetAll lists the trashed items of the given types.
+func (t TrashModel) GetAll(types []string, filters Filters) ([]*TrashItem, Metadata, error) {
+	query := fmt.Sprintf(`
+		WITH trash AS (
+			SELECT 'dish' AS type, id, name, deleted_at FROM dishes WHERE deleted_at IS NOT NULL
+			UNION ALL
+			SELECT 'drink' AS type, id, name, deleted_at FROM drinks WHERE deleted_at IS NOT NULL
+			UNION ALL
+			SELECT 'ingredient' AS type, id, name, deleted_at FROM ingredients WHERE deleted_at IS NOT NULL
+		)
+		SELECT count(*) OVER(), type, id, name, deleted_at
+		FROM trash
+		WHERE type = ANY($1)
+		ORDER BY %s %s, type ASC, id ASC
+		LIMIT $2 OFFSET $3
+	`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []interface{}{pq.Array(types), filters.limit(), filters.offset()}
+
+	rows, err := t.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer rows.Close()
+
+	totalRecords := 0
+	items := []*TrashItem{}
+
+	for rows.Next() {
+		var item TrashItem
+
+		err := rows.Scan(
+			&totalRecords,
+			&item.Type,
+			&item.ID,
+			&item.Name,
+			&item.DeletedAt,
+		)
+
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		items = append(items, &item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return items, metadata, nil
+}
+
+// Purge permanently deletes a trashed item. Purging a dish also deletes its ingredients and
+// the reviews of the dish or drink, and the dish or drink is taken out of open carts.
+func (t TrashModel) Purge(itemType, id string) error {
+	table, ok := trashTables[itemType]
+	if !ok || !validID(id) {
+		return ErrRecordNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := t.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Carts can't be placed while they hold a trashed item, so they simply lose it. Placed
+	// orders still keep the item from being purged.
+	if column, ok := orderItemColumns[itemType]; ok {
+		query := fmt.Sprintf(`
+			DELETE FROM order_items
+			USING orders
+			WHERE orders.id = order_items.order_id
+			AND orders.status = 'cart'
+			AND order_items.%s = $1
+		`, column)
+
+		_, err = tx.ExecContext(ctx, query, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	query := fmt.Sprintf(`
+		DELETE FROM %s
+		WHERE id = $1 AND deleted_at IS NOT NULL
+	`, table)
+
+	result, err := tx.ExecContext(ctx, query, id)
+	if err != nil {
+		switch violatedConstraint(err) {
+		case "order_items_dish_id_fkey", "order_items_drink_id_fkey":
+			return ErrRecordInUse
+		default:
+			return err
+		}
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return tx.Commit()
+}
+
+// PurgeExpired permanently deletes the items that were trashed before the given time and
+// returns how many were deleted. Dishes and drinks that placed orders refer to are kept, but
+// they are taken out of open carts either way.
+func (t TrashModel) PurgeExpired(before time.Time) (int64, error) {
+	cartQueries := []string{
+		`DELETE FROM order_items USING orders, dishes
+			WHERE orders.id = order_items.order_id AND orders.status = 'cart'
+			AND dishes.id = order_items.dish_id AND dishes.deleted_at < $1`,
+		`DELETE FROM order_items USING orders, drinks
+			WHERE orders.id = order_items.order_id AND orders.status = 'cart'
+			AND drinks.id = order_items.drink_id AND drinks.deleted_at < $1`,
+	}
+
+	queries := []string{
+		`DELETE FROM ingredients WHERE deleted_at < $1`,
+		`DELETE FROM dishes WHERE deleted_at < $1
+			AND NOT EXISTS (
+				SELECT 1 FROM order_items INNER JOIN orders ON orders.id = order_items.order_id
+				WHERE order_items.dish_id = dishes.id AND orders.status <> 'cart'
+			)`,
+		`DELETE FROM drinks WHERE deleted_at < $1
+			AND NOT EXISTS (
+				SELECT 1 FROM order_items INNER JOIN orders ON orders.id = order_items.order_id
+				WHERE order_items.drink_id = drinks.id AND orders.status <> 'cart'
+			)`,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := t.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	for _, query := range cartQueries {
+		_, err := tx.ExecContext(ctx, query, before)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	var purged int64
+
+	for _, query := range queries {
+		result, err := tx.ExecContext(ctx, query, before)
+		if err != nil {
+			return 0, err
+		}
+
+		rowsAffected, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+
+		purged += rowsAffected
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	return purged, nil
+}
@@ -0,0 +1,248 @@
+// Package jwt issues and verifies the compact JSON Web Tokens used by the stateless
+// authentication mode. Only HS256 and EdDSA (Ed25519) signatures are supported.
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgEdDSA = "EdDSA"
+)
+
+var (
+	// ErrInvalidToken is returned for malformed tokens, tokens with a bad signature and
+	// tokens issued by someone else.
+	ErrInvalidToken = errors.New("invalid token")
+
+	// ErrExpiredToken is returned for tokens which are past their expiry time.
+	ErrExpiredToken = errors.New("expired token")
+)
+
+var encoding = base64.RawURLEncoding
+
+// Claims is the payload of a token. Next to the registered claims it carries what the API
+// needs to authenticate and authorize a member without looking them up.
+type Claims struct {
+	ID        string `json:"jti"`
+	Subject   string `json:"sub"`
+	Issuer    string `json:"iss,omitempty"`
+	IssuedAt  int64  `json:"iat"`
+	NotBefore int64  `json:"nbf"`
+	ExpiresAt int64  `json:"exp"`
+
+	Session     string   `json:"sid,omitempty"`
+	Name        string   `json:"name,omitempty"`
+	Email       string   `json:"email,omitempty"`
+	Activated   bool     `json:"activated"`
+	Permissions []string `json:"permissions"`
+}
+
+// Expiry returns the expiry time of the token.
+func (c *Claims) Expiry() time.Time {
+	return time.Unix(c.ExpiresAt, 0)
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+}
+
+// Key signs and verifies tokens with a single algorithm.
+type Key struct {
+	// Issuer is written into the iss claim of signed tokens and, when set, required on
+	// verified tokens.
+	Issuer string
+
+	alg     string
+	secret  []byte
+	private ed25519.PrivateKey
+	public  ed25519.PublicKey
+}
+
+// NewHMACKey returns an HS256 key. The secret must be at least 32 bytes long.
+func NewHMACKey(secret []byte) (*Key, error) {
+	if len(secret) < 32 {
+		return nil, errors.New("jwt: HMAC secret must be at least 32 bytes long")
+	}
+	return &Key{alg: AlgHS256, secret: secret}, nil
+}
+
+// NewEd25519Key returns an EdDSA key.
+func NewEd25519Key(private ed25519.PrivateKey) *Key {
+	return &Key{
+		alg:     AlgEdDSA,
+		private: private,
+		public:  private.Public().(ed25519.PublicKey),
+	}
+}
+
+// LoadEd25519Key reads a PEM encoded PKCS #8 Ed25519 private key, as written by
+// "openssl genpkey -algorithm ed25519".
+func LoadEd25519Key(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("jwt: no PEM data found in %s", path)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	private, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("jwt: %s does not contain an Ed25519 private key", path)
+	}
+
+	return NewEd25519Key(private), nil
+}
+
+// Alg returns the algorithm of the key.
+func (k *Key) Alg() string {
+	return k.alg
+}
+
+// Sign fills in the ID, issuer and issued-at claims when they are missing and returns the
+// signed token.
+func (k *Key) Sign(claims *Claims) (string, error) {
+	if claims.ID == "" {
+		id, err := newID()
+		if err != nil {
+			return "", err
+		}
+		claims.ID = id
+	}
+	if claims.Issuer == "" {
+		claims.Issuer = k.Issuer
+	}
+	if claims.IssuedAt == 0 {
+		claims.IssuedAt = time.Now().Unix()
+	}
+	if claims.NotBefore == 0 {
+		claims.NotBefore = claims.IssuedAt
+	}
+
+	h, err := json.Marshal(header{Alg: k.alg, Typ: "JWT"})
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := encoding.EncodeToString(h) + "." + encoding.EncodeToString(payload)
+
+	return signingInput + "." + encoding.EncodeToString(k.signature(signingInput)), nil
+}
+
+// Verify checks the signature and the time claims of a token and returns its claims.
+func (k *Key) Verify(token string, now time.Time) (*Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	rawHeader, err := encoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var h header
+	if err := json.Unmarshal(rawHeader, &h); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	// The algorithm is fixed by the key; a token can't choose how it is verified.
+	if h.Alg != k.alg {
+		return nil, ErrInvalidToken
+	}
+
+	signature, err := encoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if !k.verify(parts[0]+"."+parts[1], signature) {
+		return nil, ErrInvalidToken
+	}
+
+	payload, err := encoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if k.Issuer != "" && claims.Issuer != k.Issuer {
+		return nil, ErrInvalidToken
+	}
+
+	if claims.NotBefore > now.Unix() {
+		return nil, ErrInvalidToken
+	}
+
+	if claims.ExpiresAt <= now.Unix() {
+		return nil, ErrExpiredToken
+	}
+
+	return &claims, nil
+}
+
+func (k *Key) signature(signingInput string) []byte {
+	switch k.alg {
+	case AlgEdDSA:
+		return ed25519.Sign(k.private, []byte(signingInput))
+	default:
+		mac := hmac.New(sha256.New, k.secret)
+		mac.Write([]byte(signingInput))
+		return mac.Sum(nil)
+	}
+}
+
+func (k *Key) verify(signingInput string, signature []byte) bool {
+	switch k.alg {
+	case AlgEdDSA:
+		return ed25519.Verify(k.public, []byte(signingInput), signature)
+	default:
+		return hmac.Equal(k.signature(signingInput), signature)
+	}
+}
+
+// IsToken reports whether s looks like a compact JWT rather than an opaque token.
+func IsToken(s string) bool {
+	return strings.Count(s, ".") == 2
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b), nil
+}
@@ -0,0 +1,197 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestKeys(t *testing.T) (*Key, *Key) {
+	t.Helper()
+
+	hmacKey, err := NewHMACKey([]byte(strings.Repeat("s", 32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return hmacKey, NewEd25519Key(private)
+}
+
+// forge builds a token with the given header and claims and a raw signature.
+func forge(t *testing.T, h header, claims Claims, signature []byte) string {
+	t.Helper()
+
+	rawHeader, err := json.Marshal(h)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return encoding.EncodeToString(rawHeader) + "." + encoding.EncodeToString(payload) + "." + encoding.EncodeToString(signature)
+}
+
+func TestNewHMACKey(t *testing.T) {
+	_, err := NewHMACKey([]byte(strings.Repeat("s", 31)))
+	if err == nil {
+		t.Error("got no error for a 31 byte secret")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	hmacKey, edKey := newTestKeys(t)
+	hmacKey.Issuer = "dishes-api"
+	edKey.Issuer = "dishes-api"
+
+	now := time.Now()
+
+	sign := func(key *Key, claims Claims) string {
+		token, err := key.Sign(&claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	valid := Claims{Subject: "1", ExpiresAt: now.Add(time.Hour).Unix(), Activated: true, Permissions: []string{"dishes:read"}}
+
+	tests := []struct {
+		name  string
+		key   *Key
+		token string
+		err   error
+	}{
+		{name: "HS256", key: hmacKey, token: sign(hmacKey, valid)},
+		{name: "EdDSA", key: edKey, token: sign(edKey, valid)},
+		{
+			name:  "signed with the other algorithm",
+			key:   hmacKey,
+			token: sign(edKey, valid),
+			err:   ErrInvalidToken,
+		},
+		{
+			name:  "header naming another algorithm",
+			key:   edKey,
+			token: forge(t, header{Alg: AlgHS256, Typ: "JWT"}, valid, nil),
+			err:   ErrInvalidToken,
+		},
+		{
+			name:  "alg none",
+			key:   hmacKey,
+			token: forge(t, header{Alg: "none", Typ: "JWT"}, valid, nil),
+			err:   ErrInvalidToken,
+		},
+		{
+			name: "tampered payload",
+			key:  hmacKey,
+			token: func() string {
+				parts := strings.Split(sign(hmacKey, valid), ".")
+				admin := valid
+				admin.Permissions = []string{"permissions:write"}
+				return strings.Join([]string{parts[0], strings.Split(forge(t, header{}, admin, nil), ".")[1], parts[2]}, ".")
+			}(),
+			err: ErrInvalidToken,
+		},
+		{
+			name: "tampered signature",
+			key:  edKey,
+			token: func() string {
+				token := sign(edKey, valid)
+				last := token[len(token)-2]
+				if last == 'A' {
+					last = 'B'
+				} else {
+					last = 'A'
+				}
+				return token[:len(token)-2] + string(last) + token[len(token)-1:]
+			}(),
+			err: ErrInvalidToken,
+		},
+		{
+			name:  "signed with another secret",
+			key:   hmacKey,
+			token: sign(&Key{alg: AlgHS256, secret: []byte(strings.Repeat("x", 32)), Issuer: "dishes-api"}, valid),
+			err:   ErrInvalidToken,
+		},
+		{
+			name: "expired",
+			key:  hmacKey,
+			token: sign(hmacKey, Claims{
+				Subject:   "1",
+				IssuedAt:  now.Add(-2 * time.Hour).Unix(),
+				ExpiresAt: now.Add(-time.Hour).Unix(),
+			}),
+			err: ErrExpiredToken,
+		},
+		{
+			name:  "expiring now",
+			key:   hmacKey,
+			token: sign(hmacKey, Claims{Subject: "1", ExpiresAt: now.Unix()}),
+			err:   ErrExpiredToken,
+		},
+		{
+			name: "not valid yet",
+			key:  hmacKey,
+			token: sign(hmacKey, Claims{
+				Subject:   "1",
+				NotBefore: now.Add(time.Minute).Unix(),
+				ExpiresAt: now.Add(time.Hour).Unix(),
+			}),
+			err: ErrInvalidToken,
+		},
+		{
+			name:  "other issuer",
+			key:   hmacKey,
+			token: sign(hmacKey, Claims{Subject: "1", Issuer: "someone-else", ExpiresAt: now.Add(time.Hour).Unix()}),
+			err:   ErrInvalidToken,
+		},
+		{name: "two parts", key: hmacKey, token: "abc.def", err: ErrInvalidToken},
+		{name: "not base64", key: hmacKey, token: "a!c.def.ghi", err: ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := tt.key.Verify(tt.token, now)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v; want %v", err, tt.err)
+			}
+
+			if tt.err != nil {
+				return
+			}
+
+			if claims.Subject != valid.Subject || !claims.Activated || claims.Issuer != "dishes-api" || claims.ID == "" {
+				t.Errorf("got claims %+v", claims)
+			}
+		})
+	}
+}
+
+func TestIsToken(t *testing.T) {
+	tests := []struct {
+		token string
+		want  bool
+	}{
+		{"a.b.c", true},
+		{"Y3K7JBWW6TWMKRQHBQM2GOUFSE", false},
+		{"a.b", false},
+		{"a.b.c.d", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsToken(tt.token); got != tt.want {
+			t.Errorf("IsToken(%q): got %t; want %t", tt.token, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"time"
+
+	texttemplate "text/template"
+)
+
+// templateFS holds the email templates. Every template defines a "subject", a "plainBody"
+// and an "htmlBody" block.
+//
+//go:embed "templates"
+var templateFS embed.FS
+
+// Message is a rendered email ready to be handed to a Transport.
+type Message struct {
+	From      string
+	To        string
+	Subject   string
+	PlainBody string
+	HTMLBody  string
+}
+
+// Transport delivers rendered messages, e.g. over SMTP or into local files.
+type Transport interface {
+	Deliver(msg *Message) error
+}
+
+// Mailer renders templated emails and sends them through its Transport.
+type Mailer struct {
+	transport Transport
+	sender    string
+}
+
+// New returns a Mailer which sends emails from the given sender address, for example
+// "Dishes <no-reply@dishes.example>".
+func New(transport Transport, sender string) Mailer {
+	return Mailer{
+		transport: transport,
+		sender:    sender,
+	}
+}
+
+// Send renders the given template file with the dynamic data and delivers it to the
+// recipient. Delivery is retried up to three times before giving up.
+func (m Mailer) Send(recipient, templateFile string, data interface{}) error {
+	msg, err := m.render(recipient, templateFile, data)
+	if err != nil {
+		return err
+	}
+
+	for i := 1; i <= 3; i++ {
+		err = m.transport.Deliver(msg)
+		if err == nil {
+			return nil
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+
+	return err
+}
+
+func (m Mailer) render(recipient, templateFile string, data interface{}) (*Message, error) {
+	textTmpl, err := texttemplate.New("email").ParseFS(templateFS, "templates/"+templateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	subject := new(bytes.Buffer)
+	err = textTmpl.ExecuteTemplate(subject, "subject", data)
+	if err != nil {
+		return nil, err
+	}
+
+	plainBody := new(bytes.Buffer)
+	err = textTmpl.ExecuteTemplate(plainBody, "plainBody", data)
+	if err != nil {
+		return nil, err
+	}
+
+	// The HTML body goes through html/template so that member supplied values are escaped.
+	htmlTmpl, err := template.New("email").ParseFS(templateFS, "templates/"+templateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	htmlBody := new(bytes.Buffer)
+	err = htmlTmpl.ExecuteTemplate(htmlBody, "htmlBody", data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Message{
+		From:      m.sender,
+		To:        recipient,
+		Subject:   subject.String(),
+		PlainBody: plainBody.String(),
+		HTMLBody:  htmlBody.String(),
+	}, nil
+}